@@ -0,0 +1,64 @@
+package fancylog
+
+import "strconv"
+
+// CallerKey is the key of the caller location added to map and field entries by
+// WithCaller
+const CallerKey = "caller"
+
+// WithCaller turn on the caller location on every line, written after the
+// timestamp of messages and as the caller key of maps and fields
+func (l *Logger) WithCaller() FancyLogger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.caller = true
+	return l
+}
+
+// WithoutCaller turn off the caller location on every line
+func (l *Logger) WithoutCaller() FancyLogger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.caller = false
+	return l
+}
+
+// CallerSkip returns a child logger skipping n more frames than l when resolving
+// the caller location, for libraries wrapping the logger to report their own
+// callers. l itself is left unchanged
+func (l *Logger) CallerSkip(n int) FancyLogger {
+	child := l.Child("")
+	child.callerSkip += n
+	return child
+}
+
+// getCaller returns the compact file:line location of the caller, an empty
+// string when the caller location is off
+func (l *Logger) getCaller() string {
+	if !l.caller {
+		return ""
+	}
+	skip := l.callerSkip
+	if skip < 0 {
+		skip = 0
+	}
+	opts := l.getStackOptions()
+	opts.Depth = skip + 1
+	frames := callerFrames(opts)
+	if len(frames) <= skip {
+		return ""
+	}
+	frame := frames[skip]
+	return framePath(frame.File, opts.FullPath) + ":" + strconv.Itoa(frame.Line)
+}
+
+func (l *Logger) writeCaller(caller string, b ColorLogger) {
+	if l.color {
+		b.Gray()
+	}
+	b.AppendString(caller)
+	b.AppendSpace()
+	if l.color {
+		b.Off()
+	}
+}
@@ -0,0 +1,170 @@
+package fancylog
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// StackTracer is implemented by errors carrying the stack they were created
+// with, the stack is written below the entry logging the error. Errors of
+// github.com/pkg/errors, whose StackTrace method returns frames instead of a
+// string, are supported as well
+type StackTracer interface {
+	StackTrace() string
+}
+
+// stackError is an error annotated with the stack of WithStack
+type stackError struct {
+	err   error
+	stack string
+}
+
+func (e *stackError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stackError) Unwrap() error {
+	return e.err
+}
+
+func (e *stackError) StackTrace() string {
+	return e.stack
+}
+
+// WithStack annotates err with the stack of the caller, which is written below
+// the entry when the error is logged. A nil err returns nil, and an err already
+// carrying a stack is returned as is
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	if hasStack(err) {
+		return err
+	}
+	return &stackError{err: err, stack: captureStack(DefaultStackOptions)}
+}
+
+// loggedError is an error rendered in an entry along with the key it was logged
+// under, its causes and stack are written below the entry
+type loggedError struct {
+	key string
+	err error
+}
+
+// errorMessage returns the message of err on a single line
+func errorMessage(err error) string {
+	return strings.ReplaceAll(err.Error(), "\n", "; ")
+}
+
+// errorCauses returns the errors wrapped by err, errors.Join and multiple %w
+// verbs wrap more than one
+func errorCauses(err error) []error {
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		return e.Unwrap()
+	case interface{ Unwrap() error }:
+		if cause := e.Unwrap(); cause != nil {
+			return []error{cause}
+		}
+	}
+	return nil
+}
+
+// hasStack reports if err, or any error it wraps on any branch, carries a
+// stack
+func hasStack(err error) bool {
+	return hasStackAt(err, 0)
+}
+
+func hasStackAt(err error, depth int) bool {
+	if err == nil || depth > maxErrorDepth {
+		return false
+	}
+	if ownStack(err) != "" {
+		return true
+	}
+	for _, cause := range errorCauses(err) {
+		if hasStackAt(cause, depth+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// ownStack returns the stack carried by err itself
+func ownStack(err error) string {
+	if st, ok := err.(StackTracer); ok {
+		return st.StackTrace()
+	}
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return ""
+	}
+	frames := fmt.Sprintf("%+v", method.Call(nil)[0].Interface())
+	return strings.TrimPrefix(strings.ReplaceAll(frames, "\n", "\n\t"), "\n") + "\n"
+}
+
+// maxErrorDepth bounds the cause chain written for a single error
+const maxErrorDepth = 16
+
+// writeErrors writes the cause tree of every error rendered in the entry below
+// it, each error followed by the stack it carries
+func (l *Logger) writeErrors(errs []loggedError, b ColorLogger) {
+	for _, logged := range errs {
+		if len(errorCauses(logged.err)) == 0 && !hasStack(logged.err) {
+			continue
+		}
+		message := errorMessage(logged.err)
+		if l.color {
+			b.Red()
+		}
+		b.AppendString("\t" + logged.key + ": " + message + "\n")
+		if l.color {
+			b.Off()
+		}
+		l.writeErrorDetails(message, logged.err, b, 1)
+	}
+}
+
+// writeErrorDetails writes the stack carried by err, then every branch of its
+// causes indented by depth. Causes repeating the message of the error wrapping
+// them, such as the errors annotated by WithStack, are merged into it
+func (l *Logger) writeErrorDetails(message string, err error, b ColorLogger, depth int) {
+	if depth > maxErrorDepth {
+		return
+	}
+	if stack := ownStack(err); stack != "" {
+		l.writeStack(indentStack(stack, depth), b)
+	}
+	for _, cause := range errorCauses(err) {
+		if cause == nil {
+			continue
+		}
+		causeMessage := errorMessage(cause)
+		if causeMessage == message {
+			l.writeErrorDetails(message, cause, b, depth)
+			continue
+		}
+		if l.color {
+			b.Red()
+		}
+		b.AppendString("\t" + strings.Repeat("  ", depth) + "caused by: " + causeMessage + "\n")
+		if l.color {
+			b.Off()
+		}
+		l.writeErrorDetails(causeMessage, cause, b, depth+1)
+	}
+}
+
+// indentStack indents every line of stack by depth levels
+func indentStack(stack string, depth int) string {
+	indent := strings.Repeat("  ", depth)
+	lines := strings.SplitAfter(stack, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "\t" + indent + strings.TrimPrefix(line, "\t")
+		}
+	}
+	return strings.Join(lines, "")
+}
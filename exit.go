@@ -0,0 +1,140 @@
+package fancylog
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultFatalHookTimeout is how long the fatal hooks of a logger are given to
+// finish before the application quits anyway
+const DefaultFatalHookTimeout = 5 * time.Second
+
+// SetExitFunc override os.Exit as the function quitting the application after a
+// fatal entry of the logger or its children, such as to test fatal paths
+func (l *Logger) SetExitFunc(exitFn func(code int)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.exitFn = exitFn
+}
+
+// AddFatalHook registers a function run after a fatal entry of the logger or
+// its children is written and before the application quits, such as flushing
+// async sinks or closing database pools. Hooks run in the order they were added,
+// those of the parents first
+func (l *Logger) AddFatalHook(hook func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fatalHooks = append(l.fatalHooks, hook)
+}
+
+// SetFatalHookTimeout override the time the fatal hooks of the logger and its
+// children are given to finish
+func (l *Logger) SetFatalHookTimeout(timeout time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fatalHookTimeout = &timeout
+}
+
+// getFatalHooks returns the fatal hooks of the parents followed by those of
+// the logger
+func (l *Logger) getFatalHooks() []func() {
+	var hooks []func()
+	if l.parent != nil {
+		hooks = l.parent.getFatalHooks()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append(hooks, l.fatalHooks...)
+}
+
+// getExitFunc returns the exit function of the logger or of its closest parent
+// setting one, nil when os.Exit is used
+func (l *Logger) getExitFunc() func(code int) {
+	l.mu.Lock()
+	exitFn := l.exitFn
+	l.mu.Unlock()
+	if exitFn == nil && l.parent != nil {
+		return l.parent.getExitFunc()
+	}
+	return exitFn
+}
+
+// getFatalHookTimeout returns the fatal hook timeout of the logger or of its
+// closest parent setting one, DefaultFatalHookTimeout otherwise
+func (l *Logger) getFatalHookTimeout() time.Duration {
+	l.mu.Lock()
+	timeout := l.fatalHookTimeout
+	l.mu.Unlock()
+	if timeout != nil {
+		return *timeout
+	}
+	if l.parent != nil {
+		return l.parent.getFatalHookTimeout()
+	}
+	return DefaultFatalHookTimeout
+}
+
+// exit runs the fatal hooks, for no longer than their timeout, then quits the
+// application with code
+func (l *Logger) exit(code int) {
+	hooks := l.getFatalHooks()
+	if len(hooks) > 0 {
+		timeout := l.getFatalHookTimeout()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runFatalHooks(hooks)
+		}()
+		timer := time.NewTimer(timeout)
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	if exitFn := l.getExitFunc(); exitFn != nil {
+		exitFn(code)
+		return
+	}
+	os.Exit(code)
+}
+
+// runFatalHooks runs every hook, a panicking hook does not prevent the
+// following ones from running
+func runFatalHooks(hooks []func()) {
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				_ = recover()
+			}()
+			hook()
+		}()
+	}
+}
+
+// Panic print panic message to output then panic with the message
+func (l *Logger) Panic(v ...interface{}) {
+	msg := fmt.Sprint(resolveLogValues(v)...)
+	l.output(Prefixes[Panic], msg+"\n", true, nil)
+	panic(msg)
+}
+
+// Panicf print formatted panic message to output then panic with the message
+func (l *Logger) Panicf(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, resolveLogValues(v)...)
+	l.output(Prefixes[Panic], msg, true, nil)
+	panic(msg)
+}
+
+// PanicMap print panic map to output then panic with the map
+func (l *Logger) PanicMap(v map[string]interface{}) {
+	l.outputMap(Prefixes[Panic], v, true, nil, nil)
+	panic(v)
+}
+
+// PanicFields print panic fields to output then panic with the fields
+func (l *Logger) PanicFields(fields ...Field) {
+	l.outputFields(Prefixes[Panic], fields, true, nil)
+	panic(fields)
+}
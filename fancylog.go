@@ -3,12 +3,13 @@ package fancylog
 import (
 	"fmt"
 	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/exp/maps"
 	"io"
-	"os"
-	"runtime"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,17 +24,26 @@ type TimestampFunc func() (time time.Time, layout string)
 
 // Logger struct define the underlying storage for single logger
 type Logger struct {
-	name           string
-	color          bool
-	out            FdWriter
-	err            FdWriter
-	debug          bool
-	trace          bool
-	timestamp      bool
-	timestampColor *Color
-	timestampFn    *TimestampFunc
-	quiet          bool
-	mu             sync.Mutex
+	name             string
+	color            bool
+	out              FdWriter
+	err              FdWriter
+	debug            bool
+	trace            bool
+	timestamp        bool
+	timestampColor   *Color
+	timestampFn      *TimestampFunc
+	quiet            bool
+	caller           bool
+	callerSkip       int
+	stackModes       atomic.Pointer[map[Level]StackMode]
+	exitFn           func(code int)
+	fatalHooks       []func()
+	fatalHookTimeout *time.Duration
+	hooks            []Hook
+	parent           *Logger
+	stackOptions     atomic.Pointer[StackOptions]
+	mu               sync.Mutex
 
 	nameFormatter *string
 }
@@ -50,6 +60,7 @@ func (l Level) toPrefix() []byte {
 
 const (
 	Fatal Level = "FATAL"
+	Panic Level = "PANIC"
 	Error Level = "ERROR"
 	Warn  Level = "WARN"
 	Info  Level = "INFO"
@@ -80,6 +91,11 @@ var Prefixes = map[Level]Prefix{
 		Color: ColorFatalRed,
 		File:  true,
 	},
+	Panic: {
+		Text:  Panic,
+		Color: ColorFatalRed,
+		File:  true,
+	},
 	Error: {
 		Text:  Error,
 		Color: ColorRed,
@@ -310,7 +326,7 @@ func (l *Logger) writePrefix(p Prefix, b ColorLogger, colorOverride *Color) {
 	b.AppendSpace()
 }
 
-func (l *Logger) writeTime(b ColorLogger) {
+func (l *Logger) writeTime(b ColorLogger, now time.Time, layout string) {
 	if l.color {
 		if l.timestampColor != nil {
 			b.WriteColor(*l.timestampColor)
@@ -319,7 +335,7 @@ func (l *Logger) writeTime(b ColorLogger) {
 		}
 
 	}
-	b.AppendTime(l.getTimeFunc()())
+	b.AppendTime(now, layout)
 	b.AppendSpace()
 	// Print reset color if color enabled
 	if l.color {
@@ -345,26 +361,33 @@ func (l *Logger) writeName(b ColorLogger) {
 	}
 }
 
-const DepthSkip = 3
-
-// getFile produces the stack trace given the caller and depth
-func (l *Logger) getStackTrace() string {
-	// Get the caller filename and line
-	pcs := make([]uintptr, 20)
-	_ = runtime.Callers(2, pcs)
-	var stack strings.Builder
-	for _, i := range pcs {
-		if i != 0 {
-			f := runtime.FuncForPC(i)
-			if !strings.HasPrefix(strings.ToLower(f.Name()), "github.com/n-ask/fancylog") {
-				file, line := f.FileLine(i)
-				stack.WriteString(fmt.Sprintf("\t%s()\n\t\t %s:%d\n", f.Name(), file, line))
+// writeHeader writes the name, prefix and timestamp starting every line
+func (l *Logger) writeHeader(b ColorLogger, prefix Prefix, prefixColorOverride *Color, now time.Time, layout string) {
+	// Write prefix to the buffer
+	if len(l.name) > 0 {
+		l.writeName(b)
+	}
+	if len(l.name) != maxNameSize {
+		for i := 0; i < (maxNameSize - len(l.name)); i++ {
+			b.AppendSpace()
+		}
+		if len(l.name) == 0 {
+			for i := 0; i < 3; i++ {
+				b.AppendSpace()
 			}
 		}
 	}
-	return stack.String()
+
+	l.writePrefix(prefix, b, prefixColorOverride)
+
+	// Check if the log require timestamping
+	if l.timestamp {
+		l.writeTime(b, now, layout)
+	}
 }
 
+const DepthSkip = 3
+
 func (l *Logger) writeStack(stack string, b ColorLogger) {
 	// Print color start if enabled
 	if l.color {
@@ -378,6 +401,24 @@ func (l *Logger) writeStack(stack string, b ColorLogger) {
 	}
 }
 
+// outputln print v formatted like fmt.Sprintln, the values are only resolved
+// and formatted when the logger is not quiet
+func (l *Logger) outputln(prefix Prefix, v []any, isErr bool, prefixColorOverride *Color) {
+	if l.IsQuiet() {
+		return
+	}
+	l.output(prefix, fmt.Sprintln(resolveLogValues(v)...), isErr, prefixColorOverride)
+}
+
+// outputf print v formatted like fmt.Sprintf, the values are only resolved and
+// formatted when the logger is not quiet
+func (l *Logger) outputf(prefix Prefix, format string, v []any, isErr bool, prefixColorOverride *Color) {
+	if l.IsQuiet() {
+		return
+	}
+	l.output(prefix, fmt.Sprintf(format, resolveLogValues(v)...), isErr, prefixColorOverride)
+}
+
 // output print the actual value
 func (l *Logger) output(prefix Prefix, data string, isErr bool, prefixColorOverride *Color) {
 
@@ -386,45 +427,47 @@ func (l *Logger) output(prefix Prefix, data string, isErr bool, prefixColorOverr
 		return
 	}
 
-	// Temporary storage for file and line tracing
-	var stack string
-
-	// Check if the specified prefix needs to be included with file logging
-	if prefix.File {
-		stack = l.getStackTrace()
+	now, layout := l.getTimeFunc()()
+	// Let the hooks observe the entry, fields they add follow the message
+	var fields map[string]any
+	if l.hasHooks() {
+		entry := &Entry{Level: prefix.Text, Time: now, Message: strings.TrimSuffix(data, "\n"), Fields: map[string]any{}}
+		if !l.fireHooks(entry) {
+			return
+		}
+		now, data, fields = entry.Time, entry.Message, entry.Fields
+		prefix, isErr, prefixColorOverride = hookedPrefix(prefix, isErr, prefixColorOverride, entry.Level)
 	}
+
+	// Capture the file and line tracing wanted for the prefix
+	stack := l.stackFor(prefix)
 	b := NewColorLogger()
 	// Reset buffer so it start from the begining
 	b.Reset()
-	// Write prefix to the buffer
-	if len(l.name) > 0 {
-		l.writeName(b)
-	}
-	if len(l.name) != maxNameSize {
-		for i := 0; i < (maxNameSize - len(l.name)); i++ {
-			b.AppendSpace()
-		}
-		if len(l.name) == 0 {
-			for i := 0; i < 3; i++ {
-				b.AppendSpace()
-			}
-		}
-	}
-
-	l.writePrefix(prefix, b, prefixColorOverride)
-
-	// Check if the log require timestamping
-	if l.timestamp {
-		l.writeTime(b)
+	l.writeHeader(b, prefix, prefixColorOverride, now, layout)
+	if caller := l.getCaller(); caller != "" {
+		l.writeCaller(caller, b)
 	}
 
 	// Print the actual string data from caller
-	b.Append([]byte(data))
-	if len(data) == 0 || data[len(data)-1] != '\n' {
+	r := l.newRenderer(b)
+	if len(fields) > 0 {
+		b.Append([]byte(strings.TrimSuffix(data, "\n")))
+		b.AppendSpace()
+		l.writeMapFields(b, r, fields, nil, "")
+		if l.color {
+			b.Off()
+		}
 		b.AppendByte('\n')
+	} else {
+		b.Append([]byte(data))
+		if len(data) == 0 || data[len(data)-1] != '\n' {
+			b.AppendByte('\n')
+		}
 	}
+	l.writeErrors(r.errs, b)
 	// Add caller filename and line if enabled
-	if prefix.File {
+	if stack != "" {
 		l.writeStack(stack, b)
 	}
 
@@ -449,44 +492,102 @@ func (l *Logger) outputMap(prefix Prefix,
 		return
 	}
 
-	// Temporary storage for file and line tracing
-	var stack string
+	// Capture the file and line tracing wanted for the prefix
+	stack := l.stackFor(prefix)
 
-	// Check if the specified prefix needs to be included with file logging
-	if prefix.File {
-		stack = l.getStackTrace()
+	l.outputMapWithStack(prefix, data, isErr, prefixColorOverride, mapKeyColorOverride, stack)
+}
+
+// outputMapWithStack print the map followed by the given stack, an empty stack
+// is omitted
+func (l *Logger) outputMapWithStack(prefix Prefix,
+	data map[string]interface{},
+	isErr bool,
+	prefixColorOverride *Color,
+	mapKeyColorOverride *map[string]Color,
+	stack string,
+) {
+	now, layout := l.getTimeFunc()()
+	// Let the hooks observe the entry, on a copy so the map of the caller is
+	// left alone
+	if l.hasHooks() {
+		entry := &Entry{Level: prefix.Text, Time: now, Fields: maps.Clone(data)}
+		if entry.Fields == nil {
+			entry.Fields = map[string]any{}
+		}
+		if !l.fireHooks(entry) {
+			return
+		}
+		now, data = entry.Time, entry.Fields
+		if entry.Level != prefix.Text {
+			prefix, isErr, prefixColorOverride = hookedPrefix(prefix, isErr, prefixColorOverride, entry.Level)
+			if stack == "" {
+				stack = l.stackFor(prefix)
+			}
+		}
 	}
+	l.writeMapEntry(prefix, data, isErr, prefixColorOverride, mapKeyColorOverride, stack, now, layout)
+}
 
+// writeMapEntry writes the map entry once the hooks let it through
+func (l *Logger) writeMapEntry(prefix Prefix,
+	data map[string]interface{},
+	isErr bool,
+	prefixColorOverride *Color,
+	mapKeyColorOverride *map[string]Color,
+	stack string,
+	now time.Time,
+	layout string,
+) {
 	b := NewColorLogger()
 
 	// Reset buffer so it start from the begining
 	b.Reset()
-	if len(l.name) > 0 {
-		l.writeName(b)
+	l.writeHeader(b, prefix, prefixColorOverride, now, layout)
+
+	r := l.newRenderer(b)
+	l.writeMapFields(b, r, data, mapKeyColorOverride, l.getCaller())
+	if l.color {
+		b.Off()
 	}
-	if len(l.name) != maxNameSize {
-		for i := 0; i < (maxNameSize - len(l.name)); i++ {
-			b.AppendSpace()
-		}
-		if len(l.name) == 0 {
-			for i := 0; i < 3; i++ {
-				b.AppendSpace()
-			}
-		}
+	b.AppendByte('\n')
+	// Add the causes and stacks of the logged errors
+	l.writeErrors(r.errs, b)
+	// Add caller filename and line if enabled
+	if stack != "" {
+		l.writeStack(stack, b)
+		b.AppendByte('\n')
 	}
 
-	l.writePrefix(prefix, b, prefixColorOverride)
-
-	// Check if the log require timestamping
-	// Check if the log require timestamping
-	if l.timestamp {
-		l.writeTime(b)
+	if isErr {
+		_, _ = l.err.Write(b.Bytes())
+	} else {
+		_, _ = l.out.Write(b.Bytes())
 	}
 
-	sortedKeys := make([]string, 0, len(data))
+	b.Free()
+	return
+}
+
+// writeMapFields writes the keys of data in order along with caller, unless
+// data holds a caller of its own
+func (l *Logger) writeMapFields(b ColorLogger,
+	r *renderer,
+	data map[string]interface{},
+	mapKeyColorOverride *map[string]Color,
+	caller string,
+) {
+	sortedKeys := make([]string, 0, len(data)+1)
 	for key := range data {
 		sortedKeys = append(sortedKeys, key)
 	}
+	// The caller location is added unless the map holds a caller of its own
+	if _, ok := data[CallerKey]; ok {
+		caller = ""
+	}
+	if caller != "" {
+		sortedKeys = append(sortedKeys, CallerKey)
+	}
 	sort.Strings(sortedKeys)
 	for _, key := range sortedKeys {
 		if l.color {
@@ -498,64 +599,14 @@ func (l *Logger) outputMap(prefix Prefix,
 			}
 		}
 		b.Append([]byte(key))
-		switch t := data[key].(type) {
-		case map[string]any:
-			b.Append([]byte("["))
-			innerSortedKeys := make([]string, 0, len(t))
-			for innerKey := range t {
-				innerSortedKeys = append(innerSortedKeys, innerKey)
-			}
-			sort.Strings(innerSortedKeys)
-			for _, sortedKey := range innerSortedKeys {
-				b.AppendSpace()
-				if l.color {
-					b.Orange()
-				}
-				b.Append([]byte(sortedKey))
-				if l.color {
-					b.White()
-				}
-				b.Append([]byte(":"))
-				if l.color {
-					b.Cyan()
-				}
-				b.Append([]byte(fmt.Sprintf("%+v", t[sortedKey])))
-				b.AppendSpace()
-			}
-			if l.color {
-				b.Purple()
-			}
-			b.Append([]byte("]"))
-			b.AppendSpace()
-		case map[string][]string:
-			b.Append([]byte("["))
-			innerSortedKeys := make([]string, 0, len(t))
-			for innerKey := range t {
-				innerSortedKeys = append(innerSortedKeys, innerKey)
-			}
-			sort.Strings(innerSortedKeys)
-			for _, sortedKey := range innerSortedKeys {
-				b.AppendSpace()
-				if l.color {
-					b.Orange()
-				}
-				b.Append([]byte(sortedKey))
-				if l.color {
-					b.White()
-				}
-				b.Append([]byte(":"))
-				if l.color {
-					b.Cyan()
-				}
-				b.Append([]byte(fmt.Sprintf("%+v", t[sortedKey])))
-				b.AppendSpace()
-			}
-			if l.color {
-				b.Purple()
-			}
-			b.Append([]byte("]"))
-			b.AppendSpace()
-		default:
+		r.key = key
+		value := reflect.ValueOf(resolveLogValue(data[key]))
+		if key == CallerKey && caller != "" {
+			value = reflect.ValueOf(caller)
+		}
+		if isNested(value) {
+			r.writeValue(value, 1)
+		} else {
 			if l.color {
 				b.Orange()
 			}
@@ -563,90 +614,80 @@ func (l *Logger) outputMap(prefix Prefix,
 			if l.color {
 				b.Cyan()
 			}
-			b.Append([]byte(fmt.Sprintf("%+v", data[key])))
-			b.AppendSpace()
+			r.writeValue(value, 1)
 		}
-
-	}
-	if l.color {
-		b.Off()
-	}
-	b.AppendByte('\n')
-	// Add caller filename and line if enabled
-	if prefix.File {
-		l.writeStack(stack, b)
-		b.AppendByte('\n')
-	}
-
-	if isErr {
-		_, _ = l.err.Write(b.Bytes())
-	} else {
-		_, _ = l.out.Write(b.Bytes())
+		b.AppendSpace()
 	}
-
-	b.Free()
-	return
 }
 
 // Fatal print fatal message to output and quit the application with status 1
 func (l *Logger) Fatal(v ...interface{}) {
-	l.output(Prefixes[Fatal], fmt.Sprintln(v...), true, nil)
-	os.Exit(1)
+	l.outputln(Prefixes[Fatal], v, true, nil)
+	l.exit(1)
 }
 
 // FatalWithCode print formatted fatal message to output and quit the application
 // with status code provider
 func (l *Logger) FatalWithCode(exit int, v ...interface{}) {
-	l.output(Prefixes[Fatal], fmt.Sprintln(v...), true, nil)
-	os.Exit(exit)
+	l.outputln(Prefixes[Fatal], v, true, nil)
+	l.exit(exit)
 }
 
 // Fatalf print formatted fatal message to output and quit the application
 // with status 1
 func (l *Logger) Fatalf(format string, v ...interface{}) {
-	l.output(Prefixes[Fatal], fmt.Sprintf(format, v...), true, nil)
-	os.Exit(1)
+	l.outputf(Prefixes[Fatal], format, v, true, nil)
+	l.exit(1)
 }
 
 // FatalWithCodef print formatted fatal message to output and quit the application
 // with status code provider
 func (l *Logger) FatalWithCodef(format string, exit int, v ...interface{}) {
-	l.output(Prefixes[Fatal], fmt.Sprintf(format, v...), true, nil)
-	os.Exit(exit)
+	l.outputf(Prefixes[Fatal], format, v, true, nil)
+	l.exit(exit)
 }
 
 func (l *Logger) FatalMap(v map[string]interface{}) {
 	l.outputMap(Prefixes[Fatal], v, true, nil, nil)
-	os.Exit(1)
+	l.exit(1)
 }
 
 func (l *Logger) FatalMapWithCode(exit int, v map[string]interface{}) {
 	l.outputMap(Prefixes[Fatal], v, true, nil, nil)
-	os.Exit(exit)
+	l.exit(exit)
 }
 
 // Error print error message to output
 func (l *Logger) Error(v ...interface{}) {
-	l.output(Prefixes[Error], fmt.Sprintln(v...), true, nil)
+	l.outputln(Prefixes[Error], v, true, nil)
 }
 
 // Errorf print formatted error message to output
 func (l *Logger) Errorf(format string, v ...interface{}) {
-	l.output(Prefixes[Error], fmt.Sprintf(format, v...), true, nil)
+	l.outputf(Prefixes[Error], format, v, true, nil)
 }
 
 func (l *Logger) ErrorMap(v map[string]interface{}) {
 	l.outputMap(Prefixes[Error], v, true, nil, nil)
 }
 
+// ErrorMapWithStack print error map to output followed by the given stack, such
+// as the stack of a recovered panic
+func (l *Logger) ErrorMapWithStack(v map[string]interface{}, stack string) {
+	if l.IsQuiet() {
+		return
+	}
+	l.outputMapWithStack(Prefixes[Error], v, true, nil, nil, stack)
+}
+
 // Warn print warning message to output
 func (l *Logger) Warn(v ...interface{}) {
-	l.output(Prefixes[Warn], fmt.Sprintln(v...), false, nil)
+	l.outputln(Prefixes[Warn], v, false, nil)
 }
 
 // Warnf print formatted warning message to output
 func (l *Logger) Warnf(format string, v ...any) {
-	l.output(Prefixes[Warn], fmt.Sprintf(format, v...), false, nil)
+	l.outputf(Prefixes[Warn], format, v, false, nil)
 }
 
 func (l *Logger) WarnMap(v map[string]interface{}) {
@@ -655,12 +696,12 @@ func (l *Logger) WarnMap(v map[string]interface{}) {
 
 // Info print informational message to output
 func (l *Logger) Info(v ...interface{}) {
-	l.output(Prefixes[Info], fmt.Sprintln(v...), false, nil)
+	l.outputln(Prefixes[Info], v, false, nil)
 }
 
 // Infof print formatted informational message to output
 func (l *Logger) Infof(format string, v ...interface{}) {
-	l.output(Prefixes[Info], fmt.Sprintf(format, v...), false, nil)
+	l.outputf(Prefixes[Info], format, v, false, nil)
 }
 
 func (l *Logger) InfoMap(v map[string]interface{}) {
@@ -670,14 +711,14 @@ func (l *Logger) InfoMap(v map[string]interface{}) {
 // Debug print debug message to output if debug output enabled
 func (l *Logger) Debug(v ...interface{}) {
 	if l.IsDebug() {
-		l.output(Prefixes[Debug], fmt.Sprintln(v...), false, nil)
+		l.outputln(Prefixes[Debug], v, false, nil)
 	}
 }
 
 // Debugf print formatted debug message to output if debug output enabled
 func (l *Logger) Debugf(format string, v ...interface{}) {
 	if l.IsDebug() {
-		l.output(Prefixes[Debug], fmt.Sprintf(format, v...), false, nil)
+		l.outputf(Prefixes[Debug], format, v, false, nil)
 	}
 }
 
@@ -690,14 +731,14 @@ func (l *Logger) DebugMap(v map[string]interface{}) {
 // Trace print trace message to output if debug output enabled
 func (l *Logger) Trace(v ...interface{}) {
 	if l.IsTrace() {
-		l.output(Prefixes[Trace], fmt.Sprintln(v...), false, nil)
+		l.outputln(Prefixes[Trace], v, false, nil)
 	}
 }
 
 // Tracef print formatted trace message to output if debug output enabled
 func (l *Logger) Tracef(format string, v ...interface{}) {
 	if l.IsTrace() {
-		l.output(Prefixes[Trace], fmt.Sprintf(format, v...), false, nil)
+		l.outputf(Prefixes[Trace], format, v, false, nil)
 	}
 }
 
@@ -709,11 +750,11 @@ func (l *Logger) TraceMap(v map[string]interface{}) {
 }
 
 func (l *Logger) Log(prefix Prefix, a ...any) {
-	l.output(prefix, fmt.Sprintln(a...), false, nil)
+	l.outputln(prefix, a, false, nil)
 }
 
 func (l *Logger) Logf(prefix Prefix, format string, a ...any) {
-	l.output(prefix, fmt.Sprintf(format, a...), false, nil)
+	l.outputf(prefix, format, a, false, nil)
 }
 
 func (l *Logger) LogMap(prefix Prefix, a map[string]any) {
@@ -0,0 +1,335 @@
+package fancylog
+
+import (
+	"math"
+	"reflect"
+	"time"
+)
+
+type fieldType uint8
+
+const (
+	stringField fieldType = iota
+	intField
+	boolField
+	durationField
+	timeField
+	timeFullField
+	errorField
+	anyField
+)
+
+// Field is a typed key/value pair. Fields are written straight into the log
+// buffer, avoiding the map and the boxing of MappedLog on hot paths
+type Field struct {
+	Key       string
+	fieldType fieldType
+	integer   int64
+	str       string
+	iface     any
+}
+
+// String constructs a field holding a string
+func String(key string, val string) Field {
+	return Field{Key: key, fieldType: stringField, str: val}
+}
+
+// Int constructs a field holding an int
+func Int(key string, val int) Field {
+	return Field{Key: key, fieldType: intField, integer: int64(val)}
+}
+
+// Int64 constructs a field holding an int64
+func Int64(key string, val int64) Field {
+	return Field{Key: key, fieldType: intField, integer: val}
+}
+
+// Bool constructs a field holding a bool
+func Bool(key string, val bool) Field {
+	var integer int64
+	if val {
+		integer = 1
+	}
+	return Field{Key: key, fieldType: boolField, integer: integer}
+}
+
+// Duration constructs a field holding a time.Duration
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, fieldType: durationField, integer: int64(val)}
+}
+
+// Times representable as int64 nanoseconds since the epoch, which Time stores
+// without boxing
+var (
+	minUnixNanoTime = time.Unix(0, math.MinInt64)
+	maxUnixNanoTime = time.Unix(0, math.MaxInt64)
+)
+
+// Time constructs a field holding a time.Time, rendered in RFC3339 format. The
+// time is stored as nanoseconds and its location, like zap does, so only times
+// outside the years 1678 to 2262 are boxed
+func Time(key string, val time.Time) Field {
+	if val.Before(minUnixNanoTime) || val.After(maxUnixNanoTime) {
+		return Field{Key: key, fieldType: timeFullField, iface: val}
+	}
+	return Field{Key: key, fieldType: timeField, integer: val.UnixNano(), iface: val.Location()}
+}
+
+// time returns the time held by a time field
+func (f Field) time() time.Time {
+	if f.fieldType == timeFullField {
+		return f.iface.(time.Time)
+	}
+	return time.Unix(0, f.integer).In(f.iface.(*time.Location))
+}
+
+// Err constructs a field holding an error under the "error" key, a nil error
+// is rendered as <nil>
+func Err(err error) Field {
+	return Field{Key: "error", fieldType: errorField, iface: err}
+}
+
+// Any constructs a field holding any value, rendered like the values of
+// MappedLog including nested maps, slices and structs
+func Any(key string, val any) Field {
+	return Field{Key: key, fieldType: anyField, iface: val}
+}
+
+// Value returns the value held by the field
+func (f Field) Value() any {
+	switch f.fieldType {
+	case stringField:
+		return f.str
+	case intField:
+		return f.integer
+	case boolField:
+		return f.integer == 1
+	case durationField:
+		return time.Duration(f.integer)
+	case timeField, timeFullField:
+		return f.time()
+	}
+	return f.iface
+}
+
+// appendValue writes the value of the field to the buffer, errors and any values
+// go through r
+func (f Field) appendValue(r *renderer, b ColorLogger) {
+	switch f.fieldType {
+	case stringField:
+		b.AppendString(f.str)
+	case intField:
+		b.AppendInt(f.integer)
+	case boolField:
+		b.AppendBool(f.integer == 1)
+	case durationField:
+		appendDuration(b, time.Duration(f.integer))
+	case timeField, timeFullField:
+		b.AppendTime(f.time(), time.RFC3339)
+	case errorField:
+		if f.iface == nil {
+			b.AppendString("<nil>")
+		} else {
+			r.writeError(f.iface.(error))
+		}
+	default:
+		r.writeValue(reflect.ValueOf(f.iface), 1)
+	}
+}
+
+// appendDuration writes d in the format of time.Duration.String for durations
+// below a second, which covers most hot path timings, without allocating
+func appendDuration(b ColorLogger, d time.Duration) {
+	switch {
+	case d < 0 || d >= time.Second:
+		b.AppendString(d.String())
+	case d == 0:
+		b.AppendString("0s")
+	case d < time.Microsecond:
+		b.AppendInt(int64(d))
+		b.AppendString("ns")
+	case d < time.Millisecond:
+		appendFraction(b, int64(d), int64(time.Microsecond))
+		b.AppendString("µs")
+	default:
+		appendFraction(b, int64(d), int64(time.Millisecond))
+		b.AppendString("ms")
+	}
+}
+
+// appendFraction writes v/unit with the trailing zeros of the fraction removed
+func appendFraction(b ColorLogger, v int64, unit int64) {
+	b.AppendInt(v / unit)
+	frac := v % unit
+	if frac == 0 {
+		return
+	}
+	digits := 0
+	for u := unit; u > 1; u /= 10 {
+		digits++
+	}
+	for frac%10 == 0 {
+		frac /= 10
+		digits--
+	}
+	b.AppendByte('.')
+	for p := pow10(digits - 1); p > frac && p > 1; p /= 10 {
+		b.AppendByte('0')
+	}
+	b.AppendInt(frac)
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for ; n > 0; n-- {
+		p *= 10
+	}
+	return p
+}
+
+func (l *Logger) outputFields(prefix Prefix, fields []Field, isErr bool, prefixColorOverride *Color) {
+	// Check if quiet is requested, and try to return no error and be quiet
+	if l.IsQuiet() {
+		return
+	}
+
+	now, layout := l.getTimeFunc()()
+	// Hooks see the fields as a map, the fields are still written in the order
+	// given with the changes of the hooks applied
+	var hooked map[string]any
+	if l.hasHooks() {
+		entry := &Entry{Level: prefix.Text, Time: now, Fields: make(map[string]any, len(fields))}
+		for _, field := range fields {
+			entry.Fields[field.Key] = field.Value()
+		}
+		if !l.fireHooks(entry) {
+			return
+		}
+		now, hooked = entry.Time, entry.Fields
+		if hooked == nil {
+			hooked = map[string]any{}
+		}
+		prefix, isErr, prefixColorOverride = hookedPrefix(prefix, isErr, prefixColorOverride, entry.Level)
+	}
+
+	// Capture the file and line tracing wanted for the prefix
+	stack := l.stackFor(prefix)
+
+	b := NewColorLogger()
+
+	// Reset buffer so it start from the begining
+	b.Reset()
+	l.writeHeader(b, prefix, prefixColorOverride, now, layout)
+
+	r := renderer{l: l, b: b}
+	for _, field := range fields {
+		var value any
+		changed := false
+		if hooked != nil {
+			var ok bool
+			if value, ok = hooked[field.Key]; !ok {
+				// Removed by a hook
+				continue
+			}
+			changed = !reflect.DeepEqual(value, field.Value())
+		}
+		l.writeFieldKey(b, field.Key)
+		r.key = field.Key
+		if changed {
+			r.writeValue(reflect.ValueOf(resolveLogValue(value)), 1)
+		} else {
+			field.appendValue(&r, b)
+		}
+		b.AppendSpace()
+	}
+	// Fields added by the hooks follow in key order
+	if hooked != nil {
+		added := map[string]any{}
+		for key, value := range hooked {
+			added[key] = value
+		}
+		for _, field := range fields {
+			delete(added, field.Key)
+		}
+		l.writeMapFields(b, &r, added, nil, "")
+	}
+	if caller := l.getCaller(); caller != "" {
+		l.writeFieldKey(b, CallerKey)
+		b.AppendString(caller)
+		b.AppendSpace()
+	}
+	if l.color {
+		b.Off()
+	}
+	b.AppendByte('\n')
+	// Add the causes and stacks of the logged errors
+	l.writeErrors(r.errs, b)
+	// Add caller filename and line if enabled
+	if stack != "" {
+		l.writeStack(stack, b)
+		b.AppendByte('\n')
+	}
+
+	if isErr {
+		_, _ = l.err.Write(b.Bytes())
+	} else {
+		_, _ = l.out.Write(b.Bytes())
+	}
+
+	b.Free()
+}
+
+// writeFieldKey writes key and its separator, leaving the value color set
+func (l *Logger) writeFieldKey(b ColorLogger, key string) {
+	if l.color {
+		b.Purple()
+	}
+	b.AppendString(key)
+	if l.color {
+		b.Orange()
+	}
+	b.AppendByte('=')
+	if l.color {
+		b.Cyan()
+	}
+}
+
+// FatalFields print fatal fields to output and quit the application with status 1
+func (l *Logger) FatalFields(fields ...Field) {
+	l.outputFields(Prefixes[Fatal], fields, true, nil)
+	l.exit(1)
+}
+
+// ErrorFields print error fields to output
+func (l *Logger) ErrorFields(fields ...Field) {
+	l.outputFields(Prefixes[Error], fields, true, nil)
+}
+
+// WarnFields print warning fields to output
+func (l *Logger) WarnFields(fields ...Field) {
+	l.outputFields(Prefixes[Warn], fields, false, nil)
+}
+
+// InfoFields print informational fields to output
+func (l *Logger) InfoFields(fields ...Field) {
+	l.outputFields(Prefixes[Info], fields, false, nil)
+}
+
+// DebugFields print debug fields to output if debug output enabled
+func (l *Logger) DebugFields(fields ...Field) {
+	if l.IsDebug() {
+		l.outputFields(Prefixes[Debug], fields, false, nil)
+	}
+}
+
+// TraceFields print trace fields to output if trace output enabled
+func (l *Logger) TraceFields(fields ...Field) {
+	if l.IsTrace() {
+		l.outputFields(Prefixes[Trace], fields, false, nil)
+	}
+}
+
+// LogFields print fields to output using the given prefix
+func (l *Logger) LogFields(prefix Prefix, fields ...Field) {
+	l.outputFields(prefix, fields, false, nil)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"github.com/n-ask/fancylog"
+	"net/http"
+)
+
+// AccessLog holds the router agnostic fields of a single served request. Every
+// adapter fills one in and hands it to WriteAccessLog so that all routers
+// produce the same access-log line
+type AccessLog struct {
+	Method   string
+	URI      string
+	Proto    string
+	User     string
+	ClientIP string
+	RemoteIP string
+	Status   int
+	Size     int
+	Headers  map[string][]string
+}
+
+// NewAccessLog extracts the access-log fields from a net/http request along with
+// the status and size recorded by the response writer
+func NewAccessLog(r *http.Request, status int, size int) AccessLog {
+	url := *r.URL
+	entry := AccessLog{
+		Method: r.Method,
+		URI:    r.RequestURI,
+		Proto:  r.Proto,
+		Status: status,
+		Size:   size,
+	}
+	if url.User != nil {
+		entry.User = url.User.Username()
+	}
+	// Without trusted proxies the remote peer is the client, adapters override
+	// ClientIP when they know better
+	entry.RemoteIP = stripPort(r.RemoteAddr)
+	entry.ClientIP = entry.RemoteIP
+	// Requests using the CONNECT method over HTTP/2.0 must use
+	// the authority field (aka r.Host) to identify the target.
+	// Refer: https://httpwg.github.io/specs/rfc7540.html#CONNECT
+	if r.ProtoMajor == 2 && r.Method == http.MethodConnect {
+		entry.URI = r.Host
+	}
+	if entry.URI == "" {
+		entry.URI = url.RequestURI()
+	}
+	entry.Headers = r.Header
+	return entry
+}
+
+// Fields returns the map rendered by the FancyHttpLog, headers are only included
+// when debugHeaders is set
+func (a AccessLog) Fields(debugHeaders bool) map[string]any {
+	msg := map[string]any{}
+	if a.User != "" {
+		msg["user"] = a.User
+	}
+	if a.ClientIP != "" {
+		msg["clientIp"] = a.ClientIP
+	}
+	if a.RemoteIP != "" {
+		msg["remoteIp"] = a.RemoteIP
+	}
+	msg["uri"] = a.URI
+	msg["proto"] = a.Proto
+	msg["status"] = a.Status
+	msg["size"] = a.Size
+
+	if debugHeaders {
+		headers := map[string][]string{}
+		for header, v := range a.Headers {
+			headers[header] = v
+		}
+		msg["headers"] = headers
+	}
+	return msg
+}
+
+// WriteAccessLog writes the entry using the method specific prefix of the logger,
+// unknown methods are written at info level with the method as a field
+func WriteAccessLog(logger fancylog.FancyHttpLog, a AccessLog) {
+	msg := a.Fields(logger.DebugHeaders())
+	switch a.Method {
+	case http.MethodGet:
+		logger.GetMethod(msg, a.Status)
+	case http.MethodConnect:
+		logger.ConnectMethod(msg, a.Status)
+	case http.MethodDelete:
+		logger.DeleteMethod(msg, a.Status)
+	case http.MethodHead:
+		logger.HeadMethod(msg, a.Status)
+	case http.MethodOptions:
+		logger.OptionsMethod(msg, a.Status)
+	case http.MethodPost:
+		logger.PostMethod(msg, a.Status)
+	case http.MethodPut:
+		logger.PutMethod(msg, a.Status)
+	case http.MethodTrace:
+		logger.TraceMethod(msg, a.Status)
+	default:
+		msg["method"] = a.Method
+		logger.InfoMap(msg)
+	}
+}
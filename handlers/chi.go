@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"github.com/n-ask/fancylog"
+	"net/http"
+)
+
+// ChiLogger is a middleware function that logs each request using FancyLog. It
+// uses the standard net/http middleware signature so it works with chi's
+// Router.Use as well as any other router built on net/http
+func ChiLogger(logger fancylog.FancyHttpLog) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return LoggingHandler(logger, nil, next)
+	}
+}
+
+// ChiLoggerWithTrustedProxies works like ChiLogger, but resolves the client
+// address through the given proxies
+func ChiLoggerWithTrustedProxies(logger fancylog.FancyHttpLog, proxies *TrustedProxies) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return LoggingHandlerWithTrustedProxies(logger, nil, next, proxies)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"path"
+	"strings"
+)
+
+// Decider reports if the call to fullMethod, which finished with err, should be
+// logged. It is evaluated by every interceptor before the fields func is called, a
+// nil Decider logs every call
+type Decider func(fullMethod string, err error) bool
+
+func (d Decider) shouldLog(fullMethod string, err error) bool {
+	if d == nil {
+		return true
+	}
+	return d(fullMethod, err)
+}
+
+// IgnoreMethods returns a Decider that skips the given full method names, such as
+// "/grpc.health.v1.Health/Check"
+func IgnoreMethods(methods ...string) Decider {
+	ignored := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		ignored[method] = struct{}{}
+	}
+	return func(fullMethod string, err error) bool {
+		_, ok := ignored[fullMethod]
+		return !ok
+	}
+}
+
+// IgnoreGlob returns a Decider that skips the full method names matching any of
+// the patterns, using the syntax of path.Match. "/grpc.health.v1.Health/*"
+// ignores every method of the health service
+func IgnoreGlob(patterns ...string) Decider {
+	return func(fullMethod string, err error) bool {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, fullMethod); matched {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// IgnoreServices returns a Decider that skips every method of the given services,
+// such as "grpc.health.v1.Health"
+func IgnoreServices(services ...string) Decider {
+	ignored := make(map[string]struct{}, len(services))
+	for _, service := range services {
+		ignored[strings.Trim(service, "/")] = struct{}{}
+	}
+	return func(fullMethod string, err error) bool {
+		service, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+		_, ok := ignored[service]
+		return !ok
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/n-ask/fancylog"
+)
+
+// EchoLogger is a middleware function that logs each request using FancyLog
+func EchoLogger(logger fancylog.FancyHttpLog) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if err != nil {
+				// Let echo write the error response so the logged status matches
+				// what the client received
+				c.Error(err)
+			}
+
+			entry := NewAccessLog(c.Request(), c.Response().Status, int(c.Response().Size))
+			entry.ClientIP = c.RealIP()
+			WriteAccessLog(logger, entry)
+			return err
+		}
+	}
+}
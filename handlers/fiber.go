@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/n-ask/fancylog"
+)
+
+// FiberLogger is a middleware function that logs each request using FancyLog.
+// Fiber is built on fasthttp rather than net/http, so the AccessLog is filled
+// in from the fiber context directly
+func FiberLogger(logger fancylog.FancyHttpLog) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if err != nil {
+			// Run the app error handler so the logged status matches what the
+			// client received
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		entry := AccessLog{
+			Method:   c.Method(),
+			URI:      c.OriginalURL(),
+			Proto:    string(c.Request().Header.Protocol()),
+			ClientIP: c.IP(),
+			RemoteIP: stripPort(c.Context().RemoteAddr().String()),
+			Status:   c.Response().StatusCode(),
+			Size:     len(c.Response().Body()),
+		}
+		if logger.DebugHeaders() {
+			entry.Headers = map[string][]string{}
+			for header, v := range c.GetReqHeaders() {
+				entry.Headers[header] = []string{v}
+			}
+		}
+		WriteAccessLog(logger, entry)
+		return nil
+	}
+}
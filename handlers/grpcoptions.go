@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"github.com/n-ask/fancylog"
+	"google.golang.org/grpc/codes"
+)
+
+// CodeToLevel returns the level a call finishing with code is logged at
+type CodeToLevel func(code codes.Code) fancylog.Level
+
+// InterceptorOption configures the logging interceptors
+type InterceptorOption func(o *interceptorOptions)
+
+type interceptorOptions struct {
+	level         fancylog.Level
+	fieldsFunc    func(ctx context.Context) map[string]any
+	decider       Decider
+	durationField string
+	codeToLevel   CodeToLevel
+
+	metadata     bool
+	metadataDeny []string
+	payload      *PayloadOptions
+}
+
+// evaluateOptions applies opts over the defaults, which log successful calls at
+// info level, failed calls according to CodeLevels and the duration as
+// grpc.duration
+func evaluateOptions(opts []InterceptorOption) *interceptorOptions {
+	o := &interceptorOptions{
+		level:         fancylog.Info,
+		durationField: "grpc.duration",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.codeToLevel == nil {
+		level := o.level
+		o.codeToLevel = func(code codes.Code) fancylog.Level {
+			return levelForCode(code, level)
+		}
+	}
+	if o.metadata {
+		o.fieldsFunc = MetadataLogFunc(o.fieldsFunc, o.metadataDeny...)
+	}
+	if o.payload != nil {
+		o.fieldsFunc = PayloadLogFunc(o.fieldsFunc, *o.payload)
+	}
+	return o
+}
+
+// fields returns the fields of the fieldsFunc, never nil
+func (o *interceptorOptions) fields(ctx context.Context) map[string]any {
+	if o.fieldsFunc == nil {
+		return map[string]any{}
+	}
+	if v := o.fieldsFunc(ctx); v != nil {
+		return v
+	}
+	return map[string]any{}
+}
+
+// WithLevel sets the level successful calls are logged at, it is ignored when
+// WithCodeToLevel is given
+func WithLevel(level fancylog.Level) InterceptorOption {
+	return func(o *interceptorOptions) {
+		o.level = level
+	}
+}
+
+// WithFieldsFunc sets the function returning the base fields of every log line,
+// such as request ids taken from the context
+func WithFieldsFunc(f func(ctx context.Context) map[string]any) InterceptorOption {
+	return func(o *interceptorOptions) {
+		o.fieldsFunc = f
+	}
+}
+
+// WithDecider sets the Decider choosing which calls are logged
+func WithDecider(decider Decider) InterceptorOption {
+	return func(o *interceptorOptions) {
+		o.decider = decider
+	}
+}
+
+// WithDurationField sets the field the call duration is logged as, an empty name
+// omits the duration
+func WithDurationField(name string) InterceptorOption {
+	return func(o *interceptorOptions) {
+		o.durationField = name
+	}
+}
+
+// WithCodeToLevel overrides the mapping of status codes, including codes.OK, to
+// log levels
+func WithCodeToLevel(f CodeToLevel) InterceptorOption {
+	return func(o *interceptorOptions) {
+		o.codeToLevel = f
+	}
+}
+
+// WithMetadata logs the call metadata as described by MetadataLogFunc
+func WithMetadata(denyKeys ...string) InterceptorOption {
+	return func(o *interceptorOptions) {
+		o.metadata = true
+		o.metadataDeny = denyKeys
+	}
+}
+
+// WithPayload logs the messages of unary calls as described by PayloadLogFunc
+func WithPayload(opts PayloadOptions) InterceptorOption {
+	return func(o *interceptorOptions) {
+		o.payload = &opts
+	}
+}
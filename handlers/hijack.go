@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hijackedConn is wrapper of a hijacked net.Conn that keeps track of how long
+// the connection lived and how many bytes moved over it, onClose is called once
+// when the connection is closed
+type hijackedConn struct {
+	net.Conn
+	opened       time.Time
+	bytesRead    int64
+	bytesWritten int64
+	closeOnce    sync.Once
+	onClose      func(c *hijackedConn)
+}
+
+func (c *hijackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.bytesRead, int64(n))
+	return n, err
+}
+
+func (c *hijackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.bytesWritten, int64(n))
+	return n, err
+}
+
+func (c *hijackedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		if c.onClose != nil {
+			c.onClose(c)
+		}
+	})
+	return err
+}
+
+func (c *hijackedConn) Duration() time.Duration {
+	return time.Since(c.opened)
+}
+
+func (c *hijackedConn) BytesRead() int64 {
+	return atomic.LoadInt64(&c.bytesRead)
+}
+
+func (c *hijackedConn) BytesWritten() int64 {
+	return atomic.LoadInt64(&c.bytesWritten)
+}
+
+// trackHijack wraps conn and rw so that all traffic, including anything the
+// server had already buffered, is counted against the returned connection
+func trackHijack(conn net.Conn, rw *bufio.ReadWriter, onClose func(c *hijackedConn)) (*hijackedConn, *bufio.ReadWriter) {
+	tracked := &hijackedConn{
+		Conn:    conn,
+		opened:  time.Now(),
+		onClose: onClose,
+	}
+	var reader io.Reader = tracked
+	if rw != nil && rw.Reader.Buffered() > 0 {
+		buffered, _ := rw.Reader.Peek(rw.Reader.Buffered())
+		tracked.bytesRead = int64(len(buffered))
+		reader = io.MultiReader(bytes.NewReader(buffered), tracked)
+	}
+	return tracked, bufio.NewReadWriter(bufio.NewReader(reader), bufio.NewWriter(tracked))
+}
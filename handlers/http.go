@@ -13,25 +13,30 @@ type loggingHandler struct {
 	writer  io.Writer
 	handler http.Handler
 	log     fancylog.FancyHttpLog
+	proxies *TrustedProxies
 }
 
 // responseLogger is wrapper of http.ResponseWriter that keeps track of its HTTP
 // status code and body size
 type responseLogger struct {
-	w      http.ResponseWriter
-	status int
-	size   int
+	w           http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+	onHijack    func(conn net.Conn, rw *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter)
 }
 
 func (l *responseLogger) Write(b []byte) (int, error) {
 	size, err := l.w.Write(b)
 	l.size += size
+	l.wroteHeader = true
 	return size, err
 }
 
 func (l *responseLogger) WriteHeader(s int) {
 	l.w.WriteHeader(s)
 	l.status = s
+	l.wroteHeader = true
 }
 
 func (l *responseLogger) Status() int {
@@ -44,78 +49,33 @@ func (l *responseLogger) Size() int {
 
 func (l *responseLogger) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	conn, rw, err := l.w.(http.Hijacker).Hijack()
-	if err == nil && l.status == 0 {
+	if err == nil && !l.wroteHeader {
 		// The status will be StatusSwitchingProtocols if there was no error and
 		// WriteHeader has not been called yet
 		l.status = http.StatusSwitchingProtocols
 	}
+	if err == nil && l.onHijack != nil {
+		conn, rw = l.onHijack(conn, rw)
+	}
 	return conn, rw, err
 }
 
 func (h loggingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	logger, w := makeLogger(w)
-	url := *r.URL
+	// Collect the request fields up front, the handler is free to modify r.URL
+	entry := NewAccessLog(r, 0, 0)
+	entry.ClientIP, entry.RemoteIP = h.proxies.ClientIP(r)
+	logger.onHijack = func(conn net.Conn, rw *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter) {
+		return h.trackHijack(entry, conn, rw)
+	}
 
 	h.handler.ServeHTTP(w, r)
 	if r.MultipartForm != nil {
 		r.MultipartForm.RemoveAll()
 	}
-	msg := map[string]any{}
-	if url.User != nil {
-		if name := url.User.Username(); name != "" {
-			msg["user"] = name
-		}
-	}
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		host = r.RemoteAddr
-		msg["host"] = host
-	}
-	msg["uri"] = r.RequestURI
-	// Requests using the CONNECT method over HTTP/2.0 must use
-	// the authority field (aka r.Host) to identify the target.
-	// Refer: https://httpwg.github.io/specs/rfc7540.html#CONNECT
-	if r.ProtoMajor == 2 && r.Method == "CONNECT" {
-		msg["uri"] = r.Host
-	}
-	if msg["uri"] == "" {
-		msg["uri"] = url.RequestURI()
-	}
-	//msg["method"] = r.Method
-	msg["proto"] = r.Proto
-	msg["status"] = logger.Status()
-	msg["size"] = logger.Size()
-
-	if h.log.DebugHeaders() {
-		headers := map[string][]string{}
-		for header, v := range r.Header {
-			headers[header] = v
-		}
-		msg["headers"] = headers
-	}
-
-	switch r.Method {
-	case http.MethodGet:
-		h.log.GetMethod(msg, logger.status)
-	case http.MethodConnect:
-		h.log.ConnectMethod(msg, logger.status)
-	case http.MethodDelete:
-		h.log.DeleteMethod(msg, logger.status)
-	case http.MethodHead:
-		h.log.HeadMethod(msg, logger.status)
-	case http.MethodOptions:
-		h.log.OptionsMethod(msg, logger.status)
-	case http.MethodPost:
-		h.log.PostMethod(msg, logger.status)
-	case http.MethodPut:
-		h.log.PutMethod(msg, logger.status)
-	case http.MethodTrace:
-		h.log.TraceMethod(msg, logger.status)
-	default:
-		msg["method"] = r.Method
-		h.log.InfoMap(msg)
-	}
-
+	entry.Status = logger.Status()
+	entry.Size = logger.Size()
+	WriteAccessLog(h.log, entry)
 }
 
 func makeLogger(w http.ResponseWriter) (*responseLogger, http.ResponseWriter) {
@@ -127,6 +87,31 @@ func makeLogger(w http.ResponseWriter) (*responseLogger, http.ResponseWriter) {
 		WriteHeader: func(httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
 			return logger.WriteHeader
 		},
+		Hijack: func(httpsnoop.HijackFunc) httpsnoop.HijackFunc {
+			return logger.Hijack
+		},
+	})
+}
+
+// trackHijack logs the open event of a hijacked connection, such as an upgraded
+// WebSocket, and wraps it so that a close event with the connection duration and
+// byte counts is logged once it is closed
+func (h loggingHandler) trackHijack(entry AccessLog, conn net.Conn, rw *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter) {
+	fields := func(event string) map[string]any {
+		return map[string]any{
+			"event":    event,
+			"uri":      entry.URI,
+			"clientIp": entry.ClientIP,
+			"remoteIp": entry.RemoteIP,
+		}
+	}
+	h.log.InfoMap(fields("hijack.open"))
+	return trackHijack(conn, rw, func(c *hijackedConn) {
+		msg := fields("hijack.close")
+		msg["duration"] = c.Duration()
+		msg["bytesRead"] = c.BytesRead()
+		msg["bytesWritten"] = c.BytesWritten()
+		h.log.InfoMap(msg)
 	})
 }
 
@@ -137,3 +122,15 @@ func LoggingHandler(log fancylog.FancyHttpLog, out io.Writer, h http.Handler) ht
 		log:     log,
 	}
 }
+
+// LoggingHandlerWithTrustedProxies works like LoggingHandler, but believes the
+// Forwarded and X-Forwarded-For headers set by the given proxies when resolving
+// the client address
+func LoggingHandlerWithTrustedProxies(log fancylog.FancyHttpLog, out io.Writer, h http.Handler, proxies *TrustedProxies) http.Handler {
+	return loggingHandler{
+		writer:  out,
+		handler: h,
+		log:     log,
+		proxies: proxies,
+	}
+}
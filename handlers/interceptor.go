@@ -4,20 +4,79 @@ import (
 	"context"
 	"github.com/n-ask/fancylog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 	"io"
+	"sync/atomic"
+	"time"
 )
 
+// CodeLevels maps the status code of a failed call to the level it is logged at
+// by the interceptors, codes missing from the map are logged as errors.
+// Successful calls are logged at the level given by WithLevel
+var CodeLevels = map[codes.Code]fancylog.Level{
+	codes.Canceled:           fancylog.Info,
+	codes.Unknown:            fancylog.Error,
+	codes.InvalidArgument:    fancylog.Info,
+	codes.DeadlineExceeded:   fancylog.Warn,
+	codes.NotFound:           fancylog.Info,
+	codes.AlreadyExists:      fancylog.Info,
+	codes.PermissionDenied:   fancylog.Warn,
+	codes.ResourceExhausted:  fancylog.Warn,
+	codes.FailedPrecondition: fancylog.Warn,
+	codes.Aborted:            fancylog.Warn,
+	codes.OutOfRange:         fancylog.Warn,
+	codes.Unimplemented:      fancylog.Error,
+	codes.Internal:           fancylog.Error,
+	codes.Unavailable:        fancylog.Warn,
+	codes.DataLoss:           fancylog.Error,
+	codes.Unauthenticated:    fancylog.Info,
+}
+
+// levelForCode returns the level a call finishing with code is logged at
+func levelForCode(code codes.Code, successLevel fancylog.Level) fancylog.Level {
+	if code == codes.OK {
+		return successLevel
+	}
+	if level, ok := CodeLevels[code]; ok {
+		return level
+	}
+	return fancylog.Error
+}
+
+// callFields adds the duration and status code of a call to logVal
+func (o *interceptorOptions) callFields(logVal map[string]any, start time.Time, err error) {
+	if o.durationField != "" {
+		logVal[o.durationField] = time.Since(start)
+	}
+	logVal["grpc.code"] = status.Code(err).String()
+}
+
+// serverCallFields adds the peer address and the deadline remaining when the call
+// started to logVal
+func serverCallFields(ctx context.Context, logVal map[string]any, start time.Time) {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		logVal["grpc.peer"] = p.Addr.String()
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		logVal["grpc.deadline"] = deadline.Sub(start)
+	}
+}
+
 func logLevelForMap(l fancylog.FancyLogger, level fancylog.Level, val map[string]any) {
 	switch level {
 	case fancylog.Fatal:
 		l.FatalMap(val)
+	case fancylog.Panic:
+		l.PanicMap(val)
 	case fancylog.Error:
 		l.ErrorMap(val)
 	case fancylog.Warn:
 		l.WarnMap(val)
 	case fancylog.Debug:
-		l.Debug(val)
+		l.DebugMap(val)
 	case fancylog.Trace:
 		l.TraceMap(val)
 	case fancylog.Info:
@@ -27,97 +86,111 @@ func logLevelForMap(l fancylog.FancyLogger, level fancylog.Level, val map[string
 	}
 }
 
-func UnaryServerInterceptor(l fancylog.FancyLogger, logLevel fancylog.Level, logFunc func(ctx context.Context) map[string]any, ignoreMethods []string) grpc.UnaryServerInterceptor {
+// UnaryServerInterceptor logs every unary call served, see InterceptorOption for
+// the available options
+func UnaryServerInterceptor(l fancylog.FancyLogger, opts ...InterceptorOption) grpc.UnaryServerInterceptor {
+	o := evaluateOptions(opts)
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
 		resp, err := handler(ctx, req)
-		if ignored(info.FullMethod, ignoreMethods) {
+		if !o.decider.shouldLog(info.FullMethod, err) {
 			return resp, err
 		}
-		logVal := logFunc(ctx)
+		logVal := o.fields(withCallPayload(ctx, info.FullMethod, req, resp))
 		logVal["grpc.method"] = info.FullMethod
+		o.callFields(logVal, start, err)
+		serverCallFields(ctx, logVal, start)
 		if err != nil {
 			logVal["error"] = err.Error()
-			l.ErrorMap(logVal)
-			return resp, err
 		}
-		logLevelForMap(l, logLevel, logVal)
+		logLevelForMap(l, o.codeToLevel(status.Code(err)), logVal)
 		return resp, err
 	}
 }
 
-func StreamServerInterceptor(l fancylog.FancyLogger, logLevel fancylog.Level, logFunc func(ctx context.Context) map[string]interface{}, ignoreMethods ...string) grpc.StreamServerInterceptor {
+// StreamServerInterceptor logs every stream served, see InterceptorOption for the
+// available options
+func StreamServerInterceptor(l fancylog.FancyLogger, opts ...InterceptorOption) grpc.StreamServerInterceptor {
+	o := evaluateOptions(opts)
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		err := handler(srv, stream)
-		if ignored(info.FullMethod, ignoreMethods) {
+		start := time.Now()
+		wrapped := wrapServerStream(stream)
+		err := handler(srv, wrapped)
+		if !o.decider.shouldLog(info.FullMethod, err) {
 			return err
 		}
-		logVal := logFunc(stream.Context())
+		logVal := o.fields(stream.Context())
 		logVal["grpc.method"] = info.FullMethod
+		o.callFields(logVal, start, err)
+		serverCallFields(stream.Context(), logVal, start)
+		streamFields(logVal, info.IsClientStream, info.IsServerStream, wrapped.Sent(), wrapped.Received())
 		if err != nil {
 			logVal["error"] = err.Error()
-			l.ErrorMap(logVal)
-			return err
 		}
-		logLevelForMap(l, logLevel, logVal)
+		logLevelForMap(l, o.codeToLevel(status.Code(err)), logVal)
 		return err
 	}
 }
 
-func UnaryClientInterceptor(l fancylog.FancyLogger, logLevel fancylog.Level, logFunc func(ctx context.Context) map[string]interface{}, ignoreMethods ...string) grpc.UnaryClientInterceptor {
-	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		err := invoker(ctx, method, req, reply, cc, opts...)
-		v := logFunc(ctx)
-		if err != nil {
-			v["error"] = err.Error()
-			l.ErrorMap(v)
+// UnaryClientInterceptor logs every unary call made, see InterceptorOption for the
+// available options
+func UnaryClientInterceptor(l fancylog.FancyLogger, opts ...InterceptorOption) grpc.UnaryClientInterceptor {
+	o := evaluateOptions(opts)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		start := time.Now()
+		var header, trailer metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(callOpts, grpc.Header(&header), grpc.Trailer(&trailer))...)
+		if !o.decider.shouldLog(method, err) {
 			return err
 		}
+		v := o.fields(withCallPayload(withCallMetadata(ctx, header, trailer), method, req, reply))
 		v["method"] = method
-		if ignored(method, ignoreMethods) {
-			return err
+		o.callFields(v, start, err)
+		if err != nil {
+			v["error"] = err.Error()
 		}
-		logLevelForMap(l, logLevel, v)
+		logLevelForMap(l, o.codeToLevel(status.Code(err)), v)
 		return err
 	}
 }
 
-func StreamClientInterceptor(l fancylog.FancyLogger, logLevel fancylog.Level, logFunc func(ctx context.Context) map[string]interface{}, ignoreMethods ...string) grpc.StreamClientInterceptor {
-	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
-		s, err := streamer(ctx, desc, cc, method, opts...)
-		var clientStream *clientStream
-		if err == nil {
-			clientStream = wrapClientStream(s, desc)
+// StreamClientInterceptor logs every stream made once it finishes, see
+// InterceptorOption for the available options
+func StreamClientInterceptor(l fancylog.FancyLogger, opts ...InterceptorOption) grpc.StreamClientInterceptor {
+	o := evaluateOptions(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		s, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			if o.decider.shouldLog(method, err) {
+				v := o.fields(withCallMetadata(ctx, nil, nil))
+				v["method"] = method
+				o.callFields(v, start, err)
+				v["error"] = err.Error()
+				logLevelForMap(l, o.codeToLevel(status.Code(err)), v)
+			}
+			return nil, err
 		}
+		clientStream := wrapClientStream(s, desc)
 		go func() {
 			err := <-clientStream.finished
-			v := logFunc(ctx)
-			if err != nil {
-				v["error"] = err.Error()
-				l.ErrorMap(v)
+			if !o.decider.shouldLog(method, err) {
 				return
 			}
+			header, _ := clientStream.ClientStream.Header()
+			v := o.fields(withCallMetadata(ctx, header, clientStream.ClientStream.Trailer()))
 			v["method"] = method
-			if ignored(method, ignoreMethods) {
-				return
+			o.callFields(v, start, err)
+			streamFields(v, desc.ClientStreams, desc.ServerStreams, clientStream.Sent(), clientStream.Received())
+			if err != nil {
+				v["error"] = err.Error()
 			}
-			logLevelForMap(l, logLevel, v)
+			logLevelForMap(l, o.codeToLevel(status.Code(err)), v)
 		}()
 		return clientStream, err
 	}
 }
 
-func ignored(method string, methods []string) bool {
-	if methods == nil {
-		return false
-	}
-	for _, m := range methods {
-		if m == method {
-			return true
-		}
-	}
-	return false
-}
-
 func wrapClientStream(s grpc.ClientStream, desc *grpc.StreamDesc) *clientStream {
 	events := make(chan streamEvent)
 	eventsDone := make(chan struct{})
@@ -163,12 +236,25 @@ type clientStream struct {
 	eventsDone chan struct{}
 	finished   chan error
 
-	receivedMessageID int
-	sentMessageID     int
+	receivedMessageID int64
+	sentMessageID     int64
+}
+
+// Sent returns the number of messages sent on the stream
+func (w *clientStream) Sent() int64 {
+	return atomic.LoadInt64(&w.sentMessageID)
+}
+
+// Received returns the number of messages received on the stream
+func (w *clientStream) Received() int64 {
+	return atomic.LoadInt64(&w.receivedMessageID)
 }
 
 func (w *clientStream) RecvMsg(m interface{}) error {
 	err := w.ClientStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&w.receivedMessageID, 1)
+	}
 
 	if err == nil && !w.desc.ServerStreams {
 		w.sendStreamEvent(receiveEndEvent, nil)
@@ -176,9 +262,6 @@ func (w *clientStream) RecvMsg(m interface{}) error {
 		w.sendStreamEvent(receiveEndEvent, nil)
 	} else if err != nil {
 		w.sendStreamEvent(errorEvent, err)
-	} else {
-		w.receivedMessageID++
-		//messageReceived.Event(w.Context(), w.receivedMessageID, m)
 	}
 
 	return err
@@ -186,11 +269,10 @@ func (w *clientStream) RecvMsg(m interface{}) error {
 func (w *clientStream) SendMsg(m interface{}) error {
 	err := w.ClientStream.SendMsg(m)
 
-	w.sentMessageID++
-	//messageSent.Event(w.Context(), w.sentMessageID, m)
-
 	if err != nil {
 		w.sendStreamEvent(errorEvent, err)
+	} else {
+		atomic.AddInt64(&w.sentMessageID, 1)
 	}
 
 	return err
@@ -237,3 +319,56 @@ const (
 	clientClosedState byte = 1 << iota
 	receiveEndedState
 )
+
+// serverStream is wrapper of grpc.ServerStream that keeps track of the number of
+// messages sent and received by the handler
+type serverStream struct {
+	grpc.ServerStream
+
+	receivedMessageID int64
+	sentMessageID     int64
+}
+
+func wrapServerStream(s grpc.ServerStream) *serverStream {
+	return &serverStream{ServerStream: s}
+}
+
+// Sent returns the number of messages sent on the stream
+func (w *serverStream) Sent() int64 {
+	return atomic.LoadInt64(&w.sentMessageID)
+}
+
+// Received returns the number of messages received on the stream
+func (w *serverStream) Received() int64 {
+	return atomic.LoadInt64(&w.receivedMessageID)
+}
+
+func (w *serverStream) RecvMsg(m interface{}) error {
+	err := w.ServerStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&w.receivedMessageID, 1)
+	}
+	return err
+}
+
+func (w *serverStream) SendMsg(m interface{}) error {
+	err := w.ServerStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&w.sentMessageID, 1)
+	}
+	return err
+}
+
+// streamFields adds the stream type and message counts to logVal
+func streamFields(logVal map[string]any, clientStreams bool, serverStreams bool, sent int64, received int64) {
+	switch {
+	case clientStreams && serverStreams:
+		logVal["grpc.stream"] = "bidi"
+	case clientStreams:
+		logVal["grpc.stream"] = "client"
+	case serverStreams:
+		logVal["grpc.stream"] = "server"
+	}
+	logVal["grpc.sent"] = sent
+	logVal["grpc.received"] = received
+}
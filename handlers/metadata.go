@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+// MetadataDenyList holds the metadata keys whose values are never logged by
+// MetadataLogFunc, keys are compared case-insensitively
+var MetadataDenyList = []string{
+	"authorization",
+	"proxy-authorization",
+	"cookie",
+	"set-cookie",
+	"x-api-key",
+	"x-auth-token",
+}
+
+const redactedValue = "[REDACTED]"
+
+// callMetadata holds the request metadata sent by a client call along with the
+// response header and trailer it received
+type callMetadata struct {
+	outgoing metadata.MD
+	header   metadata.MD
+	trailer  metadata.MD
+}
+
+type callMetadataKey struct{}
+
+// withCallMetadata stores the outgoing metadata, response header and trailer of
+// a client call in ctx so they are visible to the fields func. It also marks the
+// call as a client call, whose ctx may carry the incoming metadata of the server
+// call making it
+func withCallMetadata(ctx context.Context, header metadata.MD, trailer metadata.MD) context.Context {
+	outgoing, _ := metadata.FromOutgoingContext(ctx)
+	return context.WithValue(ctx, callMetadataKey{}, &callMetadata{outgoing: outgoing, header: header, trailer: trailer})
+}
+
+// MetadataLogFunc wraps logFunc so that the call metadata is logged along with
+// the fields it returns. Server calls log the incoming metadata, client calls log
+// the outgoing metadata along with the response header and trailer. Values of
+// keys found in MetadataDenyList or denyKeys are redacted
+func MetadataLogFunc(logFunc func(ctx context.Context) map[string]any, denyKeys ...string) func(ctx context.Context) map[string]any {
+	deny := map[string]struct{}{}
+	for _, key := range append(append([]string{}, MetadataDenyList...), denyKeys...) {
+		deny[strings.ToLower(key)] = struct{}{}
+	}
+	return func(ctx context.Context) map[string]any {
+		logVal := map[string]any{}
+		if logFunc != nil {
+			if v := logFunc(ctx); v != nil {
+				logVal = v
+			}
+		}
+		call, isClient := ctx.Value(callMetadataKey{}).(*callMetadata)
+		if !isClient {
+			if md, ok := metadata.FromIncomingContext(ctx); ok {
+				logVal["grpc.metadata"] = redactMetadata(md, deny)
+			}
+			return logVal
+		}
+		if len(call.outgoing) > 0 {
+			logVal["grpc.metadata"] = redactMetadata(call.outgoing, deny)
+		}
+		if len(call.header) > 0 {
+			logVal["grpc.header"] = redactMetadata(call.header, deny)
+		}
+		if len(call.trailer) > 0 {
+			logVal["grpc.trailer"] = redactMetadata(call.trailer, deny)
+		}
+		return logVal
+	}
+}
+
+// redactMetadata copies md into the plain map[string][]string rendered by
+// outputMap, replacing the values of denied keys
+func redactMetadata(md metadata.MD, deny map[string]struct{}) map[string][]string {
+	out := make(map[string][]string, len(md))
+	for key, values := range md {
+		if _, denied := deny[strings.ToLower(key)]; denied {
+			out[key] = []string{redactedValue}
+			continue
+		}
+		out[key] = values
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"unicode/utf8"
+)
+
+const maskedValue = "[MASKED]"
+
+// PayloadOptions controls how request and response messages are rendered by
+// PayloadLogFunc
+type PayloadOptions struct {
+	// Limit is the maximum number of bytes logged per message, 0 logs messages
+	// in full
+	Limit int
+	// MaskFields holds the proto field names whose values are masked on every
+	// method
+	MaskFields []string
+	// Mask decides if field is masked for the given method, it is consulted for
+	// fields not found in MaskFields
+	Mask func(fullMethod string, field string) bool
+}
+
+// callPayload holds the messages of a unary call
+type callPayload struct {
+	method string
+	req    any
+	resp   any
+}
+
+type callPayloadKey struct{}
+
+// withCallPayload stores the messages of a unary call in ctx so they are visible
+// to the fields func
+func withCallPayload(ctx context.Context, method string, req any, resp any) context.Context {
+	return context.WithValue(ctx, callPayloadKey{}, &callPayload{method: method, req: req, resp: resp})
+}
+
+// PayloadLogFunc wraps logFunc so that the request and response messages of
+// unary calls are logged along with the fields it returns. Proto messages are
+// rendered as JSON, other values fall back to encoding/json
+func PayloadLogFunc(logFunc func(ctx context.Context) map[string]any, opts PayloadOptions) func(ctx context.Context) map[string]any {
+	mask := map[string]struct{}{}
+	for _, field := range opts.MaskFields {
+		mask[field] = struct{}{}
+	}
+	return func(ctx context.Context) map[string]any {
+		logVal := map[string]any{}
+		if logFunc != nil {
+			if v := logFunc(ctx); v != nil {
+				logVal = v
+			}
+		}
+		call, ok := ctx.Value(callPayloadKey{}).(*callPayload)
+		if !ok {
+			return logVal
+		}
+		masked := func(field string) bool {
+			if _, ok := mask[field]; ok {
+				return true
+			}
+			return opts.Mask != nil && opts.Mask(call.method, field)
+		}
+		if call.req != nil {
+			logVal["grpc.request"] = renderPayload(call.req, masked, opts.Limit)
+		}
+		if call.resp != nil {
+			logVal["grpc.response"] = renderPayload(call.resp, masked, opts.Limit)
+		}
+		return logVal
+	}
+}
+
+// renderPayload renders msg as JSON with the masked fields replaced, truncated
+// to limit bytes
+func renderPayload(msg any, masked func(field string) bool, limit int) string {
+	var raw []byte
+	var err error
+	if m, ok := msg.(proto.Message); ok {
+		raw, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	} else {
+		raw, err = json.Marshal(msg)
+	}
+	if err != nil {
+		return fmt.Sprintf("%+v", msg)
+	}
+
+	var tree any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err == nil {
+		if maskPayload(tree, masked) {
+			if remarshaled, err := json.Marshal(tree); err == nil {
+				raw = remarshaled
+			}
+		}
+	}
+
+	if limit > 0 && len(raw) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(raw[cut]) {
+			cut--
+		}
+		return fmt.Sprintf("%s...(%d bytes truncated)", raw[:cut], len(raw)-cut)
+	}
+	return string(raw)
+}
+
+// maskPayload replaces the masked fields found anywhere in the decoded JSON
+// tree, it reports if anything was replaced
+func maskPayload(tree any, masked func(field string) bool) bool {
+	changed := false
+	switch t := tree.(type) {
+	case map[string]any:
+		for key, value := range t {
+			if masked(key) {
+				t[key] = maskedValue
+				changed = true
+				continue
+			}
+			if maskPayload(value, masked) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, value := range t {
+			if maskPayload(value, masked) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"github.com/jackc/pgx/v4"
 	"github.com/n-ask/fancylog"
-	"regexp"
 	"strings"
+	"time"
 )
 
 type PgLogger interface {
@@ -31,22 +31,25 @@ func (i IgnoreStmtPrefix) ContainsPrefix(sql string) bool {
 	return strings.HasPrefix(sql, i.Text)
 }
 
-type FancyPGLogger struct {
-	l       fancylog.FancyLogger
-	ignores *[]IgnoreStmtPrefix
-}
+// sqlSettings holds the logger and the statement handling shared by the SQL
+// loggers
+type sqlSettings struct {
+	l          fancylog.FancyLogger
+	ignores    *[]IgnoreStmtPrefix
+	argPolicy  *ArgPolicy
+	stats      *QueryStats
+	normalizer *SQLNormalizer
 
-func NewFancyPGLogger(l fancylog.FancyLogger) *FancyPGLogger {
-	return &FancyPGLogger{l: l}
+	slowQueries
 }
 
-func (l *FancyPGLogger) SetIgnoreStmtPrefixes(p []IgnoreStmtPrefix) {
-	l.ignores = &p
+func (s *sqlSettings) SetIgnoreStmtPrefixes(p []IgnoreStmtPrefix) {
+	s.ignores = &p
 }
 
-func (l *FancyPGLogger) containsIgnoredPrefix(sql string) bool {
-	if l.ignores != nil {
-		for _, prefix := range *l.ignores {
+func (s *sqlSettings) containsIgnoredPrefix(sql string) bool {
+	if s.ignores != nil {
+		for _, prefix := range *s.ignores {
 			if prefix.ContainsPrefix(sql) {
 				return true
 			}
@@ -55,18 +58,59 @@ func (l *FancyPGLogger) containsIgnoredPrefix(sql string) bool {
 	return false
 }
 
+// SetSQLNormalizer sets how statements are normalized before they are matched
+// against the ignored prefixes and logged
+func (s *sqlSettings) SetSQLNormalizer(n *SQLNormalizer) {
+	s.normalizer = n
+}
+
+func (s *sqlSettings) normalize(sql string) string {
+	if s.normalizer == nil {
+		return DefaultSQLNormalizer.Normalize(sql)
+	}
+	return s.normalizer.Normalize(sql)
+}
+
+// SetQueryStats aggregates the duration of every logged statement into stats
+func (s *sqlSettings) SetQueryStats(stats *QueryStats) {
+	s.stats = stats
+}
+
+func (s *sqlSettings) recordStats(sql string, took time.Duration, err error) {
+	if s.stats != nil {
+		s.stats.Record(sql, took, err)
+	}
+}
+
+type FancyPGLogger struct {
+	sqlSettings
+}
+
+func NewFancyPGLogger(l fancylog.FancyLogger) *FancyPGLogger {
+	return &FancyPGLogger{sqlSettings: sqlSettings{l: l}}
+}
+
 func (l *FancyPGLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
 	if val, ok := data["sql"]; ok {
 		sql := val.(string)
-		re_leadclose_whtsp := regexp.MustCompile(`^[\s\p{Zs}]+|[\s\p{Zs}]+$`)
-		re_inside_whtsp := regexp.MustCompile(`[\s\p{Zs}]{2,}`)
-		final := re_leadclose_whtsp.ReplaceAllString(sql, "")
-		final = re_inside_whtsp.ReplaceAllString(final, " ")
-		if l.containsIgnoredPrefix(sql) {
+		normalized := l.normalize(sql)
+		if l.containsIgnoredPrefix(normalized) {
 			//Eat
 			return
 		}
-		data["sql"] = final
+		args, _ := data["args"].([]interface{})
+		l.statementFields(data, normalized, args)
+		if took, ok := data["time"].(time.Duration); ok {
+			err, _ := data["err"].(error)
+			l.recordStats(sql, took, err)
+			if l.isSlow(sql, took) {
+				data["slow"] = true
+				// Escalate anything below Warn, LogLevelNone included
+				if level != pgx.LogLevelWarn && level != pgx.LogLevelError {
+					level = pgx.LogLevelWarn
+				}
+			}
+		}
 	}
 	logArgs := make([]interface{}, 0, len(data))
 	for k, v := range data {
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/n-ask/fancylog"
+	"time"
+)
+
+// FancyPGTracer logs pgx v5 queries, batches, COPY operations and connects. It
+// implements pgx.QueryTracer, pgx.BatchTracer, pgx.CopyFromTracer and
+// pgx.ConnectTracer, set it as the Tracer of a pgx.ConnConfig
+type FancyPGTracer struct {
+	sqlSettings
+}
+
+var (
+	_ pgx.QueryTracer    = (*FancyPGTracer)(nil)
+	_ pgx.BatchTracer    = (*FancyPGTracer)(nil)
+	_ pgx.CopyFromTracer = (*FancyPGTracer)(nil)
+	_ pgx.ConnectTracer  = (*FancyPGTracer)(nil)
+)
+
+func NewFancyPGTracer(l fancylog.FancyLogger) *FancyPGTracer {
+	return &FancyPGTracer{sqlSettings: sqlSettings{l: l}}
+}
+
+// traceData is carried in the context from the start to the end of a traced
+// operation, fields are copied into the end log line
+type traceData struct {
+	start   time.Time
+	sql     string
+	args    []any
+	ignored bool
+	fields  map[string]any
+}
+
+type traceDataKey struct{}
+
+func startTrace(ctx context.Context, data *traceData) context.Context {
+	data.start = time.Now()
+	return context.WithValue(ctx, traceDataKey{}, data)
+}
+
+func endTrace(ctx context.Context) *traceData {
+	if data, ok := ctx.Value(traceDataKey{}).(*traceData); ok {
+		return data
+	}
+	return &traceData{start: time.Now()}
+}
+
+// endFields returns the fields carried over from the start of the operation
+// along with fields
+func (d *traceData) endFields(fields map[string]any) map[string]any {
+	for k, v := range d.fields {
+		fields[k] = v
+	}
+	return fields
+}
+
+func connFields(conn *pgx.Conn, fields map[string]any) map[string]any {
+	if conn != nil && conn.PgConn() != nil {
+		fields["pid"] = conn.PgConn().PID()
+	}
+	return fields
+}
+
+func (t *FancyPGTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	normalized := t.normalize(data.SQL)
+	trace := &traceData{sql: data.SQL, args: data.Args, ignored: t.containsIgnoredPrefix(normalized)}
+	if !trace.ignored {
+		fields := map[string]any{"msg": "Query start"}
+		t.statementFields(fields, normalized, data.Args)
+		t.l.DebugMap(connFields(conn, fields))
+	}
+	return startTrace(ctx, trace)
+}
+
+func (t *FancyPGTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	trace := endTrace(ctx)
+	if trace.ignored {
+		return
+	}
+	took := time.Since(trace.start)
+	fields := connFields(conn, map[string]any{
+		"msg":  "Query",
+		"time": took,
+	})
+	t.statementFields(fields, t.normalize(trace.sql), trace.args)
+	t.recordStats(trace.sql, took, data.Err)
+	slow := t.isSlow(trace.sql, took)
+	if slow {
+		fields["slow"] = true
+	}
+	if data.Err != nil {
+		fields["err"] = data.Err
+		t.l.ErrorMap(fields)
+		return
+	}
+	fields["commandTag"] = data.CommandTag.String()
+	fields["rowCount"] = data.CommandTag.RowsAffected()
+	if slow {
+		t.l.WarnMap(fields)
+		return
+	}
+	t.l.InfoMap(fields)
+}
+
+func (t *FancyPGTracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	fields := connFields(conn, map[string]any{"msg": "SendBatch start"})
+	if data.Batch != nil {
+		fields["batchLen"] = data.Batch.Len()
+	}
+	t.l.DebugMap(fields)
+	return startTrace(ctx, &traceData{})
+}
+
+func (t *FancyPGTracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	normalized := t.normalize(data.SQL)
+	if t.containsIgnoredPrefix(normalized) {
+		return
+	}
+	fields := connFields(conn, map[string]any{"msg": "BatchQuery"})
+	t.statementFields(fields, normalized, data.Args)
+	if data.Err != nil {
+		fields["err"] = data.Err
+		t.l.ErrorMap(fields)
+		return
+	}
+	fields["commandTag"] = data.CommandTag.String()
+	fields["rowCount"] = data.CommandTag.RowsAffected()
+	t.l.InfoMap(fields)
+}
+
+func (t *FancyPGTracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	trace := endTrace(ctx)
+	fields := connFields(conn, map[string]any{
+		"msg":  "SendBatch",
+		"time": time.Since(trace.start),
+	})
+	if data.Err != nil {
+		fields["err"] = data.Err
+		t.l.ErrorMap(fields)
+		return
+	}
+	t.l.InfoMap(fields)
+}
+
+func (t *FancyPGTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	fields := map[string]any{
+		"tableName":   data.TableName.Sanitize(),
+		"columnNames": data.ColumnNames,
+	}
+	t.l.DebugMap(connFields(conn, map[string]any{
+		"msg":         "CopyFrom start",
+		"tableName":   fields["tableName"],
+		"columnNames": fields["columnNames"],
+	}))
+	return startTrace(ctx, &traceData{fields: fields})
+}
+
+func (t *FancyPGTracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	trace := endTrace(ctx)
+	fields := connFields(conn, trace.endFields(map[string]any{
+		"msg":  "CopyFrom",
+		"time": time.Since(trace.start),
+	}))
+	if data.Err != nil {
+		fields["err"] = data.Err
+		t.l.ErrorMap(fields)
+		return
+	}
+	fields["rowCount"] = data.CommandTag.RowsAffected()
+	t.l.InfoMap(fields)
+}
+
+func (t *FancyPGTracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	trace := &traceData{}
+	if data.ConnConfig != nil {
+		trace.fields = map[string]any{
+			"host":     data.ConnConfig.Host,
+			"port":     data.ConnConfig.Port,
+			"database": data.ConnConfig.Database,
+		}
+	}
+	return startTrace(ctx, trace)
+}
+
+func (t *FancyPGTracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	trace := endTrace(ctx)
+	fields := connFields(data.Conn, trace.endFields(map[string]any{
+		"msg":  "Connect",
+		"time": time.Since(trace.start),
+	}))
+	if data.Err != nil {
+		fields["err"] = data.Err
+		t.l.ErrorMap(fields)
+		return
+	}
+	t.l.InfoMap(fields)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"github.com/n-ask/fancylog"
+	"sync"
+	"time"
+)
+
+// PoolStat is the snapshot of a connection pool, it is satisfied by the *Stat
+// of both the pgx v4 and v5 pgxpool packages
+type PoolStat interface {
+	AcquireCount() int64
+	AcquireDuration() time.Duration
+	AcquiredConns() int32
+	CanceledAcquireCount() int64
+	ConstructingConns() int32
+	EmptyAcquireCount() int64
+	IdleConns() int32
+	MaxConns() int32
+	TotalConns() int32
+}
+
+// PoolReporter periodically logs the statistics of a connection pool. Counters
+// are reported as the change since the previous report, and the report is
+// escalated to WARN once the acquires that had to wait for a connection or the
+// average acquire duration cross their thresholds
+type PoolReporter struct {
+	l        fancylog.FancyLogger
+	stat     func() PoolStat
+	interval time.Duration
+
+	waitThreshold    int64
+	acquireThreshold time.Duration
+
+	mu       sync.Mutex
+	previous poolCounters
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type poolCounters struct {
+	acquires         int64
+	acquireDuration  time.Duration
+	canceledAcquires int64
+	waits            int64
+}
+
+// NewPoolReporter returns a reporter logging stat every interval, such as
+//
+//	handlers.NewPoolReporter(l, func() handlers.PoolStat { return pool.Stat() }, time.Minute)
+func NewPoolReporter(l fancylog.FancyLogger, stat func() PoolStat, interval time.Duration) *PoolReporter {
+	return &PoolReporter{l: l, stat: stat, interval: interval}
+}
+
+// SetWaitThreshold escalates reports where at least n acquires had to wait for a
+// connection, 0 disables the threshold
+func (r *PoolReporter) SetWaitThreshold(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waitThreshold = n
+}
+
+// SetAcquireDurationThreshold escalates reports where the average acquire took at
+// least d, 0 disables the threshold
+func (r *PoolReporter) SetAcquireDurationThreshold(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.acquireThreshold = d
+}
+
+// Start begins reporting in the background, it does nothing if the reporter is
+// already running
+func (r *PoolReporter) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		return
+	}
+	r.previous = countersOf(r.stat())
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.run(r.stop, r.done)
+}
+
+// Stop stops reporting and waits for the background goroutine to exit
+func (r *PoolReporter) Stop() {
+	r.mu.Lock()
+	stop, done := r.stop, r.done
+	r.stop, r.done = nil, nil
+	r.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (r *PoolReporter) run(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.Report()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Report logs the current statistics immediately
+func (r *PoolReporter) Report() {
+	stat := r.stat()
+	current := countersOf(stat)
+
+	r.mu.Lock()
+	previous := r.previous
+	r.previous = current
+	waitThreshold, acquireThreshold := r.waitThreshold, r.acquireThreshold
+	r.mu.Unlock()
+
+	acquires := current.acquires - previous.acquires
+	waits := current.waits - previous.waits
+	var avgAcquire time.Duration
+	if acquires > 0 {
+		avgAcquire = (current.acquireDuration - previous.acquireDuration) / time.Duration(acquires)
+	}
+
+	fields := map[string]any{
+		"msg":              "Pool stats",
+		"acquired":         stat.AcquiredConns(),
+		"idle":             stat.IdleConns(),
+		"constructing":     stat.ConstructingConns(),
+		"total":            stat.TotalConns(),
+		"max":              stat.MaxConns(),
+		"acquires":         acquires,
+		"waits":            waits,
+		"canceledAcquires": current.canceledAcquires - previous.canceledAcquires,
+		"avgAcquire":       avgAcquire,
+	}
+	if (waitThreshold > 0 && waits >= waitThreshold) || (acquireThreshold > 0 && avgAcquire >= acquireThreshold) {
+		r.l.WarnMap(fields)
+		return
+	}
+	r.l.InfoMap(fields)
+}
+
+func countersOf(stat PoolStat) poolCounters {
+	return poolCounters{
+		acquires:         stat.AcquireCount(),
+		acquireDuration:  stat.AcquireDuration(),
+		canceledAcquires: stat.CanceledAcquireCount(),
+		waits:            stat.EmptyAcquireCount(),
+	}
+}
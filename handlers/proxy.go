@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies holds the networks whose forwarding headers are believed when
+// resolving the client address of a request. A nil *TrustedProxies trusts
+// nobody, so the remote peer is always reported as the client
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// NewTrustedProxies parses the given CIDRs, plain IP addresses are accepted and
+// treated as a single host network
+func NewTrustedProxies(cidrs ...string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			t.nets = append(t.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy cidr %q: %w", cidr, err)
+		}
+		t.nets = append(t.nets, network)
+	}
+	return t, nil
+}
+
+// Trusted reports if ip belongs to one of the trusted networks
+func (t *TrustedProxies) Trusted(ip string) bool {
+	if t == nil {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range t.nets {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the originating client and the remote peer of r. The
+// Forwarded header, or X-Forwarded-For when it is absent, is walked from the
+// closest hop backwards for as long as the hops are trusted proxies, the first
+// untrusted hop is the client
+func (t *TrustedProxies) ClientIP(r *http.Request) (clientIP string, remoteIP string) {
+	remoteIP = stripPort(r.RemoteAddr)
+	if !t.Trusted(remoteIP) {
+		return remoteIP, remoteIP
+	}
+	hops := forwardedHops(r.Header)
+	if len(hops) == 0 {
+		return remoteIP, remoteIP
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !t.Trusted(hops[i]) {
+			return hops[i], remoteIP
+		}
+	}
+	return hops[0], remoteIP
+}
+
+// forwardedHops returns the client addresses recorded by proxies, the
+// originating client first
+func forwardedHops(header http.Header) []string {
+	var hops []string
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		for _, value := range values {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+					if found && strings.EqualFold(key, "for") {
+						hops = append(hops, stripPort(strings.Trim(val, `"`)))
+					}
+				}
+			}
+		}
+		return hops
+	}
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, stripPort(hop))
+			}
+		}
+	}
+	return hops
+}
+
+// stripPort removes the port, and the brackets around IPv6 addresses, from addr
+// if present
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/n-ask/fancylog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// maxPanicFrames is the maximum number of frames logged for a recovered panic
+const maxPanicFrames = 32
+
+// packagePath is the import path of this package as compiled, so the recovery
+// frame is found in forks and vendored copies too
+var packagePath = reflect.TypeOf(recoveryMarker{}).PkgPath()
+
+// recoveryMarker only exists to find the import path of this package
+type recoveryMarker struct{}
+
+// RecoveryFunc is called with the value and stack of a recovered panic, it is
+// intended for forwarding panics to an incident or metrics system
+type RecoveryFunc func(ctx context.Context, fullMethod string, p any, stack string)
+
+// UnaryServerRecoveryInterceptor recovers panics raised by the handler, logs the
+// panic value along with the stack of the panicking goroutine and returns a
+// codes.Internal error to the client. It should be chained after the logging
+// interceptor so the failed call is logged there as well. recoveryFunc may be nil
+func UnaryServerRecoveryInterceptor(l fancylog.FancyLogger, recoveryFunc RecoveryFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recoverPanic(ctx, l, info.FullMethod, p, recoveryFunc)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerRecoveryInterceptor is the streaming counterpart of
+// UnaryServerRecoveryInterceptor
+func StreamServerRecoveryInterceptor(l fancylog.FancyLogger, recoveryFunc RecoveryFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recoverPanic(stream.Context(), l, info.FullMethod, p, recoveryFunc)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+// recoverPanic logs the recovered panic p and converts it into the error returned
+// to the client, which does not carry the panic value so internals are not
+// leaked
+func recoverPanic(ctx context.Context, l fancylog.FancyLogger, fullMethod string, p any, recoveryFunc RecoveryFunc) error {
+	stack := panicStack()
+	l.ErrorMapWithStack(map[string]any{
+		"grpc.method": fullMethod,
+		"grpc.code":   codes.Internal.String(),
+		"panic":       fmt.Sprintf("%+v", p),
+	}, stack)
+	if recoveryFunc != nil {
+		recoveryFunc(ctx, fullMethod, p, stack)
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+// panicStack returns the stack of the panicking goroutine, trimmed to the frames
+// between the panic and the recovery interceptor
+func panicStack() string {
+	pcs := make([]uintptr, maxPanicFrames+16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack strings.Builder
+	panicked := false
+	written := 0
+	for {
+		frame, more := frames.Next()
+		switch {
+		case !panicked:
+			// Skip the deferred recovery up to the runtime panic machinery
+			panicked = frame.Function == "runtime.gopanic"
+		case written == 0 && strings.HasPrefix(frame.Function, "runtime."):
+			// Skip runtime frames raising the panic, such as runtime.sigpanic
+		case strings.HasPrefix(frame.Function, packagePath+"."):
+			// Reached the recovery interceptor, the rest is grpc internals
+			more = false
+		case written < maxPanicFrames:
+			stack.WriteString(fmt.Sprintf("\t%s()\n\t\t %s:%d\n", frame.Function, frame.File, frame.Line))
+			written++
+		}
+		if !more {
+			break
+		}
+	}
+	return stack.String()
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowQueries escalates statements running longer than the threshold and counts
+// their occurrences per fingerprint
+type slowQueries struct {
+	slowThreshold time.Duration
+	slowMu        sync.Mutex
+	slowCounts    map[string]int64
+}
+
+// SetSlowQueryThreshold escalates statements taking at least d to WARN, 0
+// disables slow query detection
+func (s *slowQueries) SetSlowQueryThreshold(d time.Duration) {
+	s.slowMu.Lock()
+	defer s.slowMu.Unlock()
+	s.slowThreshold = d
+}
+
+// isSlow reports if sql took long enough to be a slow query, counting it if so
+func (s *slowQueries) isSlow(sql string, took time.Duration) bool {
+	s.slowMu.Lock()
+	defer s.slowMu.Unlock()
+	if s.slowThreshold <= 0 || took < s.slowThreshold {
+		return false
+	}
+	if s.slowCounts == nil {
+		s.slowCounts = map[string]int64{}
+	}
+	s.slowCounts[fingerprintSQL(sql)]++
+	return true
+}
+
+// SlowQueries returns the number of slow occurrences per statement fingerprint
+func (s *slowQueries) SlowQueries() map[string]int64 {
+	s.slowMu.Lock()
+	defer s.slowMu.Unlock()
+	counts := make(map[string]int64, len(s.slowCounts))
+	for fingerprint, count := range s.slowCounts {
+		counts[fingerprint] = count
+	}
+	return counts
+}
+
+// ResetSlowQueries clears the slow query counters
+func (s *slowQueries) ResetSlowQueries() {
+	s.slowMu.Lock()
+	defer s.slowMu.Unlock()
+	s.slowCounts = nil
+}
+
+// DumpSlowQueries logs the slow query counters, one WARN line per fingerprint
+// starting with the most frequent
+func (s *sqlSettings) DumpSlowQueries() {
+	counts := s.SlowQueries()
+	fingerprints := make([]string, 0, len(counts))
+	for fingerprint := range counts {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	sort.Slice(fingerprints, func(i, j int) bool {
+		return counts[fingerprints[i]] > counts[fingerprints[j]]
+	})
+	for _, fingerprint := range fingerprints {
+		s.l.WarnMap(map[string]any{
+			"msg":         "Slow query",
+			"fingerprint": fingerprint,
+			"count":       counts[fingerprint],
+		})
+	}
+}
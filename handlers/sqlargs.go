@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ArgMode selects how statement arguments are logged
+type ArgMode int
+
+const (
+	// ArgsKeep logs the arguments as they are
+	ArgsKeep ArgMode = iota
+	// ArgsDrop omits the arguments
+	ArgsDrop
+	// ArgsHash logs a SHA-256 prefix of each argument, so equal values can still
+	// be correlated
+	ArgsHash
+)
+
+// DefaultRedactColumns holds the column name fragments redacted when ArgPolicy
+// has RedactByColumn set and RedactColumns is empty
+var DefaultRedactColumns = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"api_key",
+	"apikey",
+	"ssn",
+	"credit_card",
+	"card_number",
+}
+
+// ArgPolicy controls how statement arguments are logged by the SQL loggers
+type ArgPolicy struct {
+	Mode ArgMode
+	// MaxLength truncates string and []byte arguments longer than MaxLength
+	// bytes, 0 disables truncation
+	MaxLength int
+	// RedactByColumn redacts arguments bound to a column whose name contains one
+	// of RedactColumns, or DefaultRedactColumns when empty. The column is found
+	// with simple heuristics, such as "col = $1" and INSERT column lists. The $1,
+	// ?, ?NNN, :name and @name placeholder styles are understood
+	RedactByColumn bool
+	RedactColumns  []string
+	// Redact is called for every argument with the column it is bound to, if
+	// known, and returns the value to log
+	Redact func(sql string, index int, column string, value any) any
+	// Inline renders the arguments into the logged statement instead of logging
+	// them separately, so it can be copied into a SQL shell. It is intended for
+	// development only
+	Inline bool
+}
+
+var (
+	reArgPlaceholder  = regexp.MustCompile(`\$(\d+)`)
+	reArgComparison   = regexp.MustCompile(`(?i)([\w"]+)\s*(?:=|<>|!=|<=|>=|<|>|\bI?LIKE\b|\bIN\b\s*\(?)\s*\$(\d+)`)
+	reArgInsertValues = regexp.MustCompile(`(?is)INSERT\s+INTO\s+[\w".]+\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)`)
+)
+
+// SetArgPolicy sets how statement arguments are logged
+func (s *sqlSettings) SetArgPolicy(p ArgPolicy) {
+	s.argPolicy = &p
+}
+
+// statementFields sets the sql and args fields of a statement according to the
+// argument policy, sql is expected to be normalized
+func (s *sqlSettings) statementFields(fields map[string]any, sql string, args []any) {
+	s.namedStatementFields(fields, sql, args, nil)
+}
+
+// namedStatementFields is statementFields for drivers binding arguments by name,
+// names holds the name of every argument, empty for positional ones
+func (s *sqlSettings) namedStatementFields(fields map[string]any, sql string, args []any, names []string) {
+	fields["sql"] = sql
+	if len(args) == 0 {
+		return
+	}
+	p := s.argPolicy
+	if p == nil {
+		fields["args"] = args
+		return
+	}
+	if p.Mode == ArgsDrop {
+		delete(fields, "args")
+		return
+	}
+	logged := p.apply(sql, args, names)
+	if p.Inline {
+		fields["sql"] = inlineArgs(sql, logged, names)
+		delete(fields, "args")
+		return
+	}
+	fields["args"] = logged
+}
+
+// apply returns a copy of args with the policy applied
+func (p *ArgPolicy) apply(sql string, args []any, names []string) []any {
+	var columns map[int]string
+	if p.RedactByColumn || p.Redact != nil {
+		columns = argColumns(sql, names)
+	}
+	redact := p.RedactColumns
+	if len(redact) == 0 {
+		redact = DefaultRedactColumns
+	}
+
+	logged := make([]any, len(args))
+	for i, arg := range args {
+		column := columns[i+1]
+		switch {
+		case p.RedactByColumn && column != "" && columnMatches(column, redact):
+			logged[i] = redactedValue
+			continue
+		case p.Redact != nil:
+			arg = p.Redact(sql, i, column, arg)
+		}
+		if p.Mode == ArgsHash && arg != nil {
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%v", arg)))
+			logged[i] = "sha256:" + hex.EncodeToString(sum[:8])
+			continue
+		}
+		logged[i] = truncateArg(arg, p.MaxLength)
+	}
+	return logged
+}
+
+// argColumns maps argument numbers to the column they are bound to,
+// placeholders inside literals and comments are not considered
+func argColumns(sql string, names []string) map[int]string {
+	// Rewrite the statement so the heuristics only see real placeholders
+	masked := maskLiterals(sql)
+	var canonical strings.Builder
+	last := 0
+	for _, p := range argPlaceholders(masked, names) {
+		canonical.WriteString(masked[last:p.start])
+		canonical.WriteString("$" + strconv.Itoa(p.n))
+		last = p.end
+	}
+	canonical.WriteString(masked[last:])
+
+	columns := map[int]string{}
+	for _, m := range reArgComparison.FindAllStringSubmatch(canonical.String(), -1) {
+		if n, err := strconv.Atoi(m[2]); err == nil {
+			columns[n] = strings.Trim(m[1], `"`)
+		}
+	}
+	for _, m := range reArgInsertValues.FindAllStringSubmatch(canonical.String(), -1) {
+		names := strings.Split(m[1], ",")
+		values := strings.Split(m[2], ",")
+		for i := 0; i < len(names) && i < len(values); i++ {
+			placeholder := reArgPlaceholder.FindStringSubmatch(strings.TrimSpace(values[i]))
+			if placeholder == nil {
+				continue
+			}
+			if n, err := strconv.Atoi(placeholder[1]); err == nil {
+				columns[n] = strings.Trim(strings.TrimSpace(names[i]), `"`)
+			}
+		}
+	}
+	return columns
+}
+
+// argPlaceholder is a placeholder found in a statement, n is the number of the
+// argument it is bound to
+type argPlaceholder struct {
+	start int
+	end   int
+	n     int
+}
+
+// argPlaceholders returns the placeholders of masked, a statement whose
+// literals were blanked by maskLiterals. Postgres $1 placeholders are used when
+// present, otherwise the ? and ?NNN placeholders of sqlite and MySQL along with
+// the :name and @name placeholders matching names
+func argPlaceholders(masked string, names []string) []argPlaceholder {
+	var placeholders []argPlaceholder
+	for _, loc := range reArgPlaceholder.FindAllStringSubmatchIndex(masked, -1) {
+		// Identifiers such as a$1 hold no placeholder
+		if loc[0] > 0 && isWordPart(masked[loc[0]-1]) {
+			continue
+		}
+		if n, err := strconv.Atoi(masked[loc[2]:loc[3]]); err == nil {
+			placeholders = append(placeholders, argPlaceholder{start: loc[0], end: loc[1], n: n})
+		}
+	}
+	if len(placeholders) > 0 {
+		return placeholders
+	}
+
+	// A bare ? is bound to the argument after the highest one used so far, as
+	// sqlite does
+	highest := 0
+	for i := 0; i < len(masked); {
+		c := masked[i]
+		switch {
+		case c == '"':
+			i = quoteEnd(masked, i)
+		case c == '?':
+			end := i + 1
+			for end < len(masked) && masked[end] >= '0' && masked[end] <= '9' {
+				end++
+			}
+			n := highest + 1
+			if end > i+1 {
+				n, _ = strconv.Atoi(masked[i+1 : end])
+			}
+			if n > highest {
+				highest = n
+			}
+			placeholders = append(placeholders, argPlaceholder{start: i, end: end, n: n})
+			i = end
+		case (c == ':' || c == '@') && len(names) > 0 && (i == 0 || masked[i-1] != ':') &&
+			i+1 < len(masked) && isWordStart(masked[i+1]) && masked[i+1] != '$':
+			end := i + 2
+			for end < len(masked) && isWordPart(masked[end]) {
+				end++
+			}
+			for j, name := range names {
+				if name != "" && name == masked[i+1:end] {
+					placeholders = append(placeholders, argPlaceholder{start: i, end: end, n: j + 1})
+					if j+1 > highest {
+						highest = j + 1
+					}
+					break
+				}
+			}
+			i = end
+		case isWordPart(c):
+			// Skip words so a ? or : inside them is not taken apart
+			for i < len(masked) && isWordPart(masked[i]) {
+				i++
+			}
+		default:
+			i++
+		}
+	}
+	return placeholders
+}
+
+// maskLiterals returns sql with the string literals, dollar-quoted strings and
+// comments replaced by spaces, keeping the offsets of everything else. Quoted
+// identifiers are kept as they may name columns
+func maskLiterals(sql string) string {
+	masked := []byte(sql)
+	blank := func(start, end int) {
+		for i := start; i < end; i++ {
+			masked[i] = ' '
+		}
+	}
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			end := quoteEnd(sql, i)
+			blank(i, end)
+			i = end
+		case c == '"':
+			i = quoteEnd(sql, i)
+		case c == '$' && dollarTag(sql, i) != "":
+			end := dollarQuoteEnd(sql, i)
+			blank(i, end)
+			i = end
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += i
+			}
+			blank(i, end)
+			i = end
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += i + 4
+			}
+			blank(i, end)
+			i = end
+		default:
+			i++
+		}
+	}
+	return string(masked)
+}
+
+func columnMatches(column string, fragments []string) bool {
+	column = strings.ToLower(column)
+	for _, fragment := range fragments {
+		if strings.Contains(column, strings.ToLower(fragment)) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncateArg(arg any, maxLength int) any {
+	if maxLength <= 0 {
+		return arg
+	}
+	switch v := arg.(type) {
+	case string:
+		if len(v) > maxLength {
+			cut := maxLength
+			for cut > 0 && !utf8.RuneStart(v[cut]) {
+				cut--
+			}
+			return fmt.Sprintf("%s...(%d bytes truncated)", v[:cut], len(v)-cut)
+		}
+	case []byte:
+		if len(v) > maxLength {
+			return fmt.Sprintf("%x...(%d bytes truncated)", v[:maxLength], len(v)-maxLength)
+		}
+	}
+	return arg
+}
+
+// inlineArgs replaces the placeholders of sql with the literal of the matching
+// argument, placeholders inside literals and comments are left alone
+func inlineArgs(sql string, args []any, names []string) string {
+	var out strings.Builder
+	last := 0
+	for _, p := range argPlaceholders(maskLiterals(sql), names) {
+		if p.n < 1 || p.n > len(args) {
+			continue
+		}
+		out.WriteString(sql[last:p.start])
+		out.WriteString(sqlLiteral(args[p.n-1]))
+		last = p.end
+	}
+	out.WriteString(sql[last:])
+	return out.String()
+}
+
+func sqlLiteral(arg any) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strconv.FormatBool(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("%v", v)
+	case []byte:
+		return `'\x` + hex.EncodeToString(v) + `'`
+	case time.Time:
+		return "'" + v.Format(time.RFC3339Nano) + "'"
+	case fmt.Stringer:
+		return "'" + strings.ReplaceAll(v.String(), "'", "''") + "'"
+	default:
+		return "'" + strings.ReplaceAll(fmt.Sprintf("%v", v), "'", "''") + "'"
+	}
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/n-ask/fancylog"
+	"time"
+)
+
+// FancySQLDriver wraps a database/sql driver so that queries, execs, prepares
+// and transactions are logged through a FancyLogger. Register it with
+// sql.Register, or use OpenConnector with sql.OpenDB. Statements are ignored,
+// normalized and their arguments redacted the same way as FancyPGLogger
+type FancySQLDriver struct {
+	*sqlSettings
+	driver driver.Driver
+}
+
+var (
+	_ driver.Driver        = (*FancySQLDriver)(nil)
+	_ driver.DriverContext = (*FancySQLDriver)(nil)
+)
+
+func NewFancySQLDriver(l fancylog.FancyLogger, d driver.Driver) *FancySQLDriver {
+	return &FancySQLDriver{sqlSettings: &sqlSettings{l: l}, driver: d}
+}
+
+func (d *FancySQLDriver) Open(name string) (driver.Conn, error) {
+	start := time.Now()
+	conn, err := d.driver.Open(name)
+	if err != nil {
+		d.logOperation("Connect", start, err)
+		return nil, err
+	}
+	return &sqlConn{settings: d.sqlSettings, conn: conn}, nil
+}
+
+func (d *FancySQLDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &FancySQLConnector{sqlSettings: d.sqlSettings, connector: connector, driver: d}, nil
+	}
+	return &FancySQLConnector{sqlSettings: d.sqlSettings, connector: dsnConnector{name: name, driver: d.driver}, driver: d}, nil
+}
+
+// FancySQLConnector wraps a driver.Connector, use it with sql.OpenDB
+type FancySQLConnector struct {
+	*sqlSettings
+	connector driver.Connector
+	driver    driver.Driver
+}
+
+var _ driver.Connector = (*FancySQLConnector)(nil)
+
+func NewFancySQLConnector(l fancylog.FancyLogger, c driver.Connector) *FancySQLConnector {
+	settings := &sqlSettings{l: l}
+	return &FancySQLConnector{
+		sqlSettings: settings,
+		connector:   c,
+		driver:      &FancySQLDriver{sqlSettings: settings, driver: c.Driver()},
+	}
+}
+
+func (c *FancySQLConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	start := time.Now()
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		c.logOperation("Connect", start, err)
+		return nil, err
+	}
+	return &sqlConn{settings: c.sqlSettings, conn: conn}, nil
+}
+
+func (c *FancySQLConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// dsnConnector is the driver.Connector of drivers which do not implement
+// driver.DriverContext
+type dsnConnector struct {
+	name   string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// logStatement logs a finished statement, escalating slow statements to WARN.
+// driver.ErrSkip is not logged, database/sql retries the statement through a
+// prepared statement which is logged instead
+func (s *sqlSettings) logStatement(msg string, sql string, args []driver.NamedValue, start time.Time, result driver.Result, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	normalized := s.normalize(sql)
+	if s.containsIgnoredPrefix(normalized) {
+		return
+	}
+	took := time.Since(start)
+	values := make([]any, len(args))
+	names := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+		names[i] = arg.Name
+	}
+	fields := map[string]any{
+		"msg":  msg,
+		"time": took,
+	}
+	s.namedStatementFields(fields, normalized, values, names)
+	s.recordStats(sql, took, err)
+	slow := s.isSlow(sql, took)
+	if slow {
+		fields["slow"] = true
+	}
+	if err != nil {
+		fields["err"] = err
+		s.l.ErrorMap(fields)
+		return
+	}
+	if result != nil {
+		if rows, rowsErr := result.RowsAffected(); rowsErr == nil {
+			fields["rowCount"] = rows
+		}
+	}
+	if slow {
+		s.l.WarnMap(fields)
+		return
+	}
+	s.l.InfoMap(fields)
+}
+
+// logOperation logs a finished operation without a statement, such as a commit
+func (s *sqlSettings) logOperation(msg string, start time.Time, err error) {
+	fields := map[string]any{
+		"msg":  msg,
+		"time": time.Since(start),
+	}
+	if err != nil {
+		fields["err"] = err
+		s.l.ErrorMap(fields)
+		return
+	}
+	s.l.InfoMap(fields)
+}
+
+type sqlConn struct {
+	settings *sqlSettings
+	conn     driver.Conn
+}
+
+var (
+	_ driver.Conn               = (*sqlConn)(nil)
+	_ driver.ConnPrepareContext = (*sqlConn)(nil)
+	_ driver.ConnBeginTx        = (*sqlConn)(nil)
+	_ driver.ExecerContext      = (*sqlConn)(nil)
+	_ driver.QueryerContext     = (*sqlConn)(nil)
+	_ driver.Pinger             = (*sqlConn)(nil)
+	_ driver.SessionResetter    = (*sqlConn)(nil)
+	_ driver.Validator          = (*sqlConn)(nil)
+	_ driver.NamedValueChecker  = (*sqlConn)(nil)
+)
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *sqlConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	start := time.Now()
+	var stmt driver.Stmt
+	var err error
+	if pc, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = pc.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		c.settings.logStatement("Prepare", query, nil, start, nil, err)
+		return nil, err
+	}
+	if normalized := c.settings.normalize(query); c.settings.l.IsDebug() && !c.settings.containsIgnoredPrefix(normalized) {
+		c.settings.l.DebugMap(map[string]any{
+			"msg":  "Prepare",
+			"sql":  normalized,
+			"time": time.Since(start),
+		})
+	}
+	return &sqlStmt{settings: c.settings, stmt: stmt, query: query}, nil
+}
+
+func (c *sqlConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var tx driver.Tx
+	var err error
+	if bc, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = bc.BeginTx(ctx, opts)
+	} else if opts.Isolation != 0 {
+		// Refuse the options the wrapped driver cannot honour, as database/sql
+		// does for drivers without BeginTx
+		err = errors.New("sql: driver does not support non-default isolation level")
+	} else if opts.ReadOnly {
+		err = errors.New("sql: driver does not support read-only transactions")
+	} else {
+		tx, err = c.conn.Begin()
+	}
+	c.settings.logOperation("Begin", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{settings: c.settings, tx: tx}, nil
+}
+
+func (c *sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := ec.ExecContext(ctx, query, args)
+	c.settings.logStatement("Exec", query, args, start, result, err)
+	return result, err
+}
+
+func (c *sqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	c.settings.logStatement("Query", query, args, start, nil, err)
+	return rows, err
+}
+
+func (c *sqlConn) Ping(ctx context.Context) error {
+	if p, ok := c.conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *sqlConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *sqlConn) IsValid() bool {
+	if v, ok := c.conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *sqlConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := c.conn.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type sqlStmt struct {
+	settings *sqlSettings
+	stmt     driver.Stmt
+	query    string
+}
+
+var (
+	_ driver.Stmt              = (*sqlStmt)(nil)
+	_ driver.StmtExecContext   = (*sqlStmt)(nil)
+	_ driver.StmtQueryContext  = (*sqlStmt)(nil)
+	_ driver.NamedValueChecker = (*sqlStmt)(nil)
+)
+
+func (s *sqlStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *sqlStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *sqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var result driver.Result
+	var err error
+	if ec, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = ec.ExecContext(ctx, args)
+	} else {
+		result, err = s.stmt.Exec(driverValues(args))
+	}
+	s.settings.logStatement("Exec", s.query, args, start, result, err)
+	return result, err
+}
+
+func (s *sqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if qc, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else {
+		rows, err = s.stmt.Query(driverValues(args))
+	}
+	s.settings.logStatement("Query", s.query, args, start, nil, err)
+	return rows, err
+}
+
+func (s *sqlStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type sqlTx struct {
+	settings *sqlSettings
+	tx       driver.Tx
+}
+
+func (t *sqlTx) Commit() error {
+	start := time.Now()
+	err := t.tx.Commit()
+	t.settings.logOperation("Commit", start, err)
+	return err
+}
+
+func (t *sqlTx) Rollback() error {
+	start := time.Now()
+	err := t.tx.Rollback()
+	t.settings.logOperation("Rollback", start, err)
+	return err
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+func driverValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
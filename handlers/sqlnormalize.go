@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// NormalizeOptions selects the transformations applied by a SQLNormalizer
+type NormalizeOptions struct {
+	// CollapseWhitespace trims the statement and replaces runs of whitespace
+	// with a single space
+	CollapseWhitespace bool
+	// StripComments removes -- and /* */ comments
+	StripComments bool
+	// MaxLength truncates statements longer than MaxLength bytes, 0 disables
+	// truncation
+	MaxLength int
+	// UppercaseKeywords uppercases SQL keywords outside of literals and quoted
+	// identifiers
+	UppercaseKeywords bool
+}
+
+// SQLNormalizer rewrites statements into the form they are logged and matched
+// against IgnoreStmtPrefix in. It is safe for concurrent use
+type SQLNormalizer struct {
+	opts NormalizeOptions
+}
+
+// DefaultSQLNormalizer collapses whitespace, it is used by the SQL loggers until
+// SetSQLNormalizer is called
+var DefaultSQLNormalizer = NewSQLNormalizer(NormalizeOptions{CollapseWhitespace: true})
+
+var (
+	reLeadCloseWhitespace = regexp.MustCompile(`^[\s\p{Zs}]+|[\s\p{Zs}]+$`)
+	reInsideWhitespace    = regexp.MustCompile(`[\s\p{Zs}]{2,}|[\t\n\v\f\r\p{Zs}]`)
+)
+
+var sqlKeywords = map[string]struct{}{}
+
+func init() {
+	for _, keyword := range strings.Fields(`ALL ALTER AND ANY AS ASC BEGIN BETWEEN BY CASE CAST COMMIT
+		CONFLICT CREATE CROSS DEFAULT DELETE DESC DISTINCT DO DROP ELSE END EXCEPT EXISTS FALSE
+		FETCH FOR FROM FULL GROUP HAVING ILIKE IN INDEX INNER INSERT INTERSECT INTO IS JOIN LEFT
+		LIKE LIMIT LOCK NOT NOTHING NULL OFFSET ON OR ORDER OUTER RETURNING RIGHT ROLLBACK SELECT
+		SET TABLE THEN TO TRUE UNION UPDATE USING VALUES WHEN WHERE WITH`) {
+		sqlKeywords[strings.ToLower(keyword)] = struct{}{}
+	}
+}
+
+func NewSQLNormalizer(opts NormalizeOptions) *SQLNormalizer {
+	return &SQLNormalizer{opts: opts}
+}
+
+// Normalize returns sql with the configured transformations applied
+func (n *SQLNormalizer) Normalize(sql string) string {
+	if n.opts.StripComments || n.opts.UppercaseKeywords {
+		sql = n.rewrite(sql)
+	}
+	if n.opts.CollapseWhitespace {
+		sql = reLeadCloseWhitespace.ReplaceAllString(sql, "")
+		sql = reInsideWhitespace.ReplaceAllString(sql, " ")
+	}
+	if n.opts.MaxLength > 0 && len(sql) > n.opts.MaxLength {
+		cut := n.opts.MaxLength
+		for cut > 0 && !utf8.RuneStart(sql[cut]) {
+			cut--
+		}
+		sql = sql[:cut] + "..."
+	}
+	return sql
+}
+
+// rewrite strips comments and uppercases keywords in a single pass, leaving
+// string literals, dollar-quoted strings and quoted identifiers untouched
+func (n *SQLNormalizer) rewrite(sql string) string {
+	var out strings.Builder
+	out.Grow(len(sql))
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := quoteEnd(sql, i)
+			out.WriteString(sql[i:end])
+			i = end
+		case c == '$' && dollarTag(sql, i) != "":
+			end := dollarQuoteEnd(sql, i)
+			out.WriteString(sql[i:end])
+			i = end
+		case n.opts.StripComments && c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end
+			}
+			out.WriteByte(' ')
+		case n.opts.StripComments && c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 4
+			}
+			out.WriteByte(' ')
+		case isWordStart(c):
+			end := i + 1
+			for end < len(sql) && isWordPart(sql[end]) {
+				end++
+			}
+			word := sql[i:end]
+			if _, ok := sqlKeywords[strings.ToLower(word)]; ok && n.opts.UppercaseKeywords {
+				word = strings.ToUpper(word)
+			}
+			out.WriteString(word)
+			i = end
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// quoteEnd returns the index after the literal or quoted identifier starting at
+// start, doubled quotes are treated as escapes
+func quoteEnd(sql string, start int) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] == quote {
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag returns the opening delimiter of the Postgres dollar-quoted string,
+// such as $$ or $body$, starting at start. Parameters such as $1 are not quotes
+func dollarTag(sql string, start int) string {
+	i := start + 1
+	if i < len(sql) && sql[i] >= '0' && sql[i] <= '9' {
+		return ""
+	}
+	for i < len(sql) && sql[i] != '$' {
+		if !isWordPart(sql[i]) {
+			return ""
+		}
+		i++
+	}
+	if i >= len(sql) {
+		return ""
+	}
+	return sql[start : i+1]
+}
+
+// dollarQuoteEnd returns the index after the dollar-quoted string starting at
+// start, which ends at the next occurrence of its opening delimiter
+func dollarQuoteEnd(sql string, start int) int {
+	tag := dollarTag(sql, start)
+	end := strings.Index(sql[start+len(tag):], tag)
+	if end < 0 {
+		return len(sql)
+	}
+	return start + len(tag) + end + len(tag)
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= utf8.RuneSelf
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/n-ask/fancylog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// querySamples is the number of most recent durations kept per fingerprint for
+// the percentile
+const querySamples = 512
+
+var (
+	reFingerprintString = regexp.MustCompile(`'(?:[^']|'')*'`)
+	reFingerprintNumber = regexp.MustCompile(`\b-?\d+(?:\.\d+)?(?:[eE][-+]?\d+)?\b`)
+	reFingerprintParam  = regexp.MustCompile(`\$\d+`)
+	reFingerprintList   = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+
+	fingerprintNormalizer = NewSQLNormalizer(NormalizeOptions{CollapseWhitespace: true, StripComments: true})
+)
+
+// fingerprintSQL returns the key statements are grouped by, the normalized
+// statement with comments removed and literals, placeholders and lists of them
+// replaced by ?
+func fingerprintSQL(sql string) string {
+	fingerprint := fingerprintNormalizer.Normalize(sql)
+	fingerprint = reFingerprintString.ReplaceAllString(fingerprint, "?")
+	fingerprint = reFingerprintParam.ReplaceAllString(fingerprint, "?")
+	fingerprint = reFingerprintNumber.ReplaceAllString(fingerprint, "?")
+	return reFingerprintList.ReplaceAllString(fingerprint, "(?...)")
+}
+
+// QueryStat is the aggregate of every execution of a statement fingerprint
+type QueryStat struct {
+	Fingerprint string        `json:"fingerprint"`
+	Count       int64         `json:"count"`
+	Errors      int64         `json:"errors"`
+	Total       time.Duration `json:"total"`
+	Avg         time.Duration `json:"avg"`
+	P95         time.Duration `json:"p95"`
+	Max         time.Duration `json:"max"`
+}
+
+type queryStat struct {
+	count   int64
+	errors  int64
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration
+	next    int
+}
+
+// QueryStats aggregates statement durations and errors per fingerprint in
+// process. It is an http.Handler serving the aggregates as JSON
+type QueryStats struct {
+	mu    sync.Mutex
+	stats map[string]*queryStat
+}
+
+func NewQueryStats() *QueryStats {
+	return &QueryStats{stats: map[string]*queryStat{}}
+}
+
+// Record adds an execution of sql to the aggregates
+func (s *QueryStats) Record(sql string, took time.Duration, err error) {
+	fingerprint := fingerprintSQL(sql)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat, ok := s.stats[fingerprint]
+	if !ok {
+		stat = &queryStat{}
+		s.stats[fingerprint] = stat
+	}
+	stat.count++
+	if err != nil {
+		stat.errors++
+	}
+	stat.total += took
+	if took > stat.max {
+		stat.max = took
+	}
+	if len(stat.samples) < querySamples {
+		stat.samples = append(stat.samples, took)
+	} else {
+		stat.samples[stat.next] = took
+		stat.next = (stat.next + 1) % querySamples
+	}
+}
+
+// Snapshot returns the aggregates ordered by total duration, the most expensive
+// statement first
+func (s *QueryStats) Snapshot() []QueryStat {
+	s.mu.Lock()
+	snapshot := make([]QueryStat, 0, len(s.stats))
+	for fingerprint, stat := range s.stats {
+		samples := append([]time.Duration{}, stat.samples...)
+		snapshot = append(snapshot, QueryStat{
+			Fingerprint: fingerprint,
+			Count:       stat.count,
+			Errors:      stat.errors,
+			Total:       stat.total,
+			Avg:         stat.total / time.Duration(stat.count),
+			P95:         percentile(samples, 0.95),
+			Max:         stat.max,
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Total > snapshot[j].Total
+	})
+	return snapshot
+}
+
+// Reset clears the aggregates
+func (s *QueryStats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = map[string]*queryStat{}
+}
+
+// LogSummary logs the top statements by total duration as a table, top <= 0
+// logs every statement
+func (s *QueryStats) LogSummary(l fancylog.FancyLogger, top int) {
+	snapshot := s.Snapshot()
+	if len(snapshot) == 0 {
+		return
+	}
+	if top > 0 && len(snapshot) > top {
+		snapshot = snapshot[:top]
+	}
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "\tCOUNT\tERRORS\tTOTAL\tAVG\tP95\tMAX\tQUERY")
+	for _, stat := range snapshot {
+		_, _ = fmt.Fprintf(w, "\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n", stat.Count, stat.Errors,
+			stat.Total.Round(time.Microsecond), stat.Avg.Round(time.Microsecond),
+			stat.P95.Round(time.Microsecond), stat.Max.Round(time.Microsecond), stat.Fingerprint)
+	}
+	_ = w.Flush()
+	l.Info("Query statistics\n" + strings.TrimSuffix(table.String(), "\n"))
+}
+
+// StartReporting logs the summary every interval until the returned stop
+// function is called
+func (s *QueryStats) StartReporting(l fancylog.FancyLogger, interval time.Duration, top int) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				s.LogSummary(l, top)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+func (s *QueryStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Snapshot())
+}
+
+// percentile returns the p-th percentile of samples, sorting them in place
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	index := int(float64(len(samples))*p+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(samples) {
+		index = len(samples) - 1
+	}
+	return samples[index]
+}
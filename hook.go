@@ -0,0 +1,116 @@
+package fancylog
+
+import "time"
+
+// Entry is a log entry handed to the hooks before it is written. Message holds
+// the text of messages and is empty for map and field entries, Fields holds the
+// keys of map and field entries and is empty for messages. Hooks may change any
+// of them, fields added to a message are written after it and a changed level
+// writes the entry with the prefix and writer of that level
+type Entry struct {
+	Level   Level
+	Time    time.Time
+	Message string
+	Fields  map[string]any
+}
+
+// Hook observes entries before they are written, such as to count errors,
+// forward them or add fields to every entry. Returning false drops the entry
+type Hook interface {
+	Fire(entry *Entry) bool
+}
+
+// HookFunc adapts a function to the Hook interface
+type HookFunc func(entry *Entry) bool
+
+// Fire calls the function
+func (f HookFunc) Fire(entry *Entry) bool {
+	return f(entry)
+}
+
+// hookedPrefix returns the prefix, writer and prefix color of an entry whose
+// level may have been changed by a hook. Levels missing from Prefixes keep the
+// color of the original prefix
+func hookedPrefix(prefix Prefix, isErr bool, prefixColorOverride *Color, level Level) (Prefix, bool, *Color) {
+	if level == prefix.Text {
+		return prefix, isErr, prefixColorOverride
+	}
+	hooked, ok := Prefixes[level]
+	if !ok {
+		hooked = Prefix{Text: level, Color: prefix.Color}
+	}
+	return hooked, level == Fatal || level == Panic || level == Error, nil
+}
+
+// AddHook registers a hook run on every entry of the logger and its children,
+// hooks run in the order they were added
+func (l *Logger) AddHook(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+func (l *Logger) getHooks() []Hook {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.hooks
+}
+
+// hasHooks reports if the logger or one of its parents has hooks
+func (l *Logger) hasHooks() bool {
+	for logger := l; logger != nil; logger = logger.parent {
+		if len(logger.getHooks()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fireHooks runs the hooks of the parents, then those of the logger, stopping
+// at the first one dropping the entry
+func (l *Logger) fireHooks(entry *Entry) bool {
+	if l.parent != nil && !l.parent.fireHooks(entry) {
+		return false
+	}
+	for _, hook := range l.getHooks() {
+		if !hook.Fire(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// Child returns a logger writing to the same outputs with the settings of l,
+// an empty name keeps the name of l. Entries of the child run the hooks of l,
+// including those added later, before its own, and fatal entries of the child
+// run the fatal hooks of l the same way. The exit function and fatal hook
+// timeout of l apply to the child until it sets its own
+func (l *Logger) Child(name string) *Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if name == "" {
+		name = l.name
+	}
+	if maxNameSize < len(name) {
+		maxNameSize = len(name)
+	}
+	child := &Logger{
+		name:           name,
+		color:          l.color,
+		out:            l.out,
+		err:            l.err,
+		debug:          l.debug,
+		trace:          l.trace,
+		timestamp:      l.timestamp,
+		timestampColor: l.timestampColor,
+		timestampFn:    l.timestampFn,
+		quiet:          l.quiet,
+		caller:         l.caller,
+		callerSkip:     l.callerSkip,
+		parent:         l,
+		nameFormatter:  l.nameFormatter,
+	}
+	child.stackModes.Store(l.stackModes.Load())
+	child.stackOptions.Store(l.stackOptions.Load())
+	return child
+}
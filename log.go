@@ -4,6 +4,7 @@ type FancyLogger interface {
 	StandardLog
 	FormatLog
 	MappedLog
+	FieldLog
 	PrefixLog
 
 	WithColor() FancyLogger
@@ -20,6 +21,9 @@ type FancyLogger interface {
 	NoQuiet() FancyLogger
 	IsQuiet() bool
 	HasColor() bool
+	WithCaller() FancyLogger
+	WithoutCaller() FancyLogger
+	CallerSkip(n int) FancyLogger
 
 	output(prefix Prefix, data string, isErr bool, prefixColorOverride *Color)
 	outputMap(prefix Prefix, data map[string]interface{}, isErr bool, prefixColorOverride *Color, mapKeyColorOverride *map[string]Color)
@@ -32,6 +36,7 @@ type StandardLog interface {
 	Error(a ...any)
 	Trace(a ...any)
 	Fatal(a ...any)
+	Panic(a ...any)
 }
 
 type FormatLog interface {
@@ -41,6 +46,7 @@ type FormatLog interface {
 	Errorf(format string, a ...any)
 	Tracef(format string, a ...any)
 	Fatalf(format string, a ...any)
+	Panicf(format string, a ...any)
 }
 
 type MappedLog interface {
@@ -48,12 +54,25 @@ type MappedLog interface {
 	DebugMap(a map[string]any)
 	WarnMap(a map[string]any)
 	ErrorMap(a map[string]any)
+	ErrorMapWithStack(a map[string]any, stack string)
 	TraceMap(a map[string]any)
 	FatalMap(a map[string]any)
+	PanicMap(a map[string]any)
+}
+
+type FieldLog interface {
+	InfoFields(fields ...Field)
+	DebugFields(fields ...Field)
+	WarnFields(fields ...Field)
+	ErrorFields(fields ...Field)
+	TraceFields(fields ...Field)
+	FatalFields(fields ...Field)
+	PanicFields(fields ...Field)
 }
 
 type PrefixLog interface {
 	Log(prefix Prefix, a ...any)
 	Logf(prefix Prefix, format string, a ...any)
 	LogMap(prefix Prefix, a map[string]any)
+	LogFields(prefix Prefix, fields ...Field)
 }
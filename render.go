@@ -0,0 +1,296 @@
+package fancylog
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MaxRenderDepth limits how deeply nested maps, slices and structs are rendered
+// by the map and field loggers, deeper values are written as "..."
+var MaxRenderDepth = 5
+
+var (
+	logValuerType = reflect.TypeOf((*LogValuer)(nil)).Elem()
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	stringerType  = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// renderer writes arbitrary values into the log buffer, keeping track of the
+// references being rendered so that cyclic values terminate
+type renderer struct {
+	l       *Logger
+	b       ColorLogger
+	visited map[uintptr]struct{}
+
+	// key and path hold the keys leading to the value being rendered, errs the
+	// errors rendered so far whose details are written below the entry
+	key  string
+	path []string
+	errs []loggedError
+}
+
+func (l *Logger) newRenderer(b ColorLogger) *renderer {
+	return &renderer{l: l, b: b}
+}
+
+// isNested reports if v is rendered as a bracketed list of key:value pairs
+func isNested(v reflect.Value) bool {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Map
+}
+
+// writeValue writes v, recursing into maps, slices, arrays, structs and
+// pointers up to MaxRenderDepth
+func (r *renderer) writeValue(v reflect.Value, depth int) {
+	if !v.IsValid() {
+		r.b.AppendString("<nil>")
+		return
+	}
+	if v.Kind() != reflect.Interface && v.CanInterface() && v.Type().Implements(logValuerType) {
+		if value := v.Interface(); !isNilPointer(value) {
+			v = reflect.ValueOf(resolveLogValue(value))
+		}
+	}
+	r.writeResolved(v, depth)
+}
+
+// writeResolved writes v without consulting LogValuer, so a value resolving to
+// itself is rendered by its structure
+func (r *renderer) writeResolved(v reflect.Value, depth int) {
+	if !v.IsValid() {
+		r.b.AppendString("<nil>")
+		return
+	}
+	if v.Kind() != reflect.Interface && v.CanInterface() {
+		// Types describing themselves are trusted over their structure
+		if v.Type().Implements(errorType) || v.Type().Implements(stringerType) {
+			if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+				r.b.AppendString("<nil>")
+				return
+			}
+			if err, ok := v.Interface().(error); ok {
+				r.writeError(err)
+				return
+			}
+			r.b.AppendString(fmt.Sprintf("%+v", v.Interface()))
+			return
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			r.b.AppendString("<nil>")
+			return
+		}
+		r.writeValue(v.Elem(), depth)
+	case reflect.Pointer:
+		if v.IsNil() {
+			r.b.AppendString("<nil>")
+			return
+		}
+		if !r.enter(v) {
+			return
+		}
+		r.writeValue(v.Elem(), depth)
+		r.leave(v)
+	case reflect.Map:
+		r.writeMap(v, depth)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			r.b.AppendString(fmt.Sprintf("%+v", v.Interface()))
+			return
+		}
+		r.writeList(v, depth)
+	case reflect.Struct:
+		r.writeStruct(v, depth)
+	default:
+		if v.CanInterface() {
+			r.b.AppendString(fmt.Sprintf("%+v", v.Interface()))
+		} else {
+			r.b.AppendString(v.String())
+		}
+	}
+}
+
+// writeError writes the message of err on a single line and records it so its
+// causes and stack are written below the entry
+func (r *renderer) writeError(err error) {
+	r.b.AppendString(errorMessage(err))
+	if len(errorCauses(err)) == 0 && !hasStack(err) {
+		return
+	}
+	key := r.key
+	if len(r.path) > 0 {
+		key += "." + strings.Join(r.path, ".")
+	}
+	r.errs = append(r.errs, loggedError{key: key, err: err})
+}
+
+// push appends key to the path of the nested value being rendered
+func (r *renderer) push(key string) {
+	r.path = append(r.path, key)
+}
+
+func (r *renderer) pop() {
+	r.path = r.path[:len(r.path)-1]
+}
+
+// enter marks the reference held by v as being rendered, it returns false and
+// writes a marker when v is already being rendered further up
+func (r *renderer) enter(v reflect.Value) bool {
+	ptr := v.Pointer()
+	if ptr == 0 {
+		return true
+	}
+	if r.visited == nil {
+		r.visited = map[uintptr]struct{}{}
+	}
+	if _, ok := r.visited[ptr]; ok {
+		r.b.AppendString("<cycle>")
+		return false
+	}
+	r.visited[ptr] = struct{}{}
+	return true
+}
+
+func (r *renderer) leave(v reflect.Value) {
+	delete(r.visited, v.Pointer())
+}
+
+// writeMap writes v as "[ key:value  key:value ]" with the keys sorted
+func (r *renderer) writeMap(v reflect.Value, depth int) {
+	if v.IsNil() {
+		r.b.AppendString("<nil>")
+		return
+	}
+	if depth > MaxRenderDepth {
+		r.b.AppendString("[...]")
+		return
+	}
+	if !r.enter(v) {
+		return
+	}
+	keys := v.MapKeys()
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = fmt.Sprintf("%v", key.Interface())
+	}
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return names[order[i]] < names[order[j]]
+	})
+
+	r.b.AppendString("[")
+	for _, i := range order {
+		r.b.AppendSpace()
+		r.writeKey(names[i])
+		r.push(names[i])
+		r.writeValue(v.MapIndex(keys[i]), depth+1)
+		r.pop()
+		r.b.AppendSpace()
+	}
+	if r.l.color {
+		r.b.Purple()
+	}
+	r.b.AppendString("]")
+	r.leave(v)
+}
+
+// writeList writes v as "[value value]", the layout of %+v
+func (r *renderer) writeList(v reflect.Value, depth int) {
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		r.b.AppendString("[]")
+		return
+	}
+	if depth > MaxRenderDepth {
+		r.b.AppendString("[...]")
+		return
+	}
+	if v.Kind() == reflect.Slice && v.Len() > 0 {
+		if !r.enter(v) {
+			return
+		}
+		defer r.leave(v)
+	}
+	r.b.AppendString("[")
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			r.b.AppendSpace()
+		}
+		r.writeValue(v.Index(i), depth+1)
+		if r.l.color {
+			r.b.Cyan()
+		}
+	}
+	r.b.AppendString("]")
+}
+
+// writeStruct writes the exported fields of v as "{ field:value }". The log
+// struct tag renames a field, `log:"-"` skips it and the omitempty option skips
+// it when it holds the zero value
+func (r *renderer) writeStruct(v reflect.Value, depth int) {
+	if depth > MaxRenderDepth {
+		r.b.AppendString("{...}")
+		return
+	}
+	t := v.Type()
+	r.b.AppendString("{")
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		omitEmpty := false
+		if tag, ok := field.Tag.Lookup("log"); ok {
+			if tag == "-" {
+				continue
+			}
+			tagName, options, _ := strings.Cut(tag, ",")
+			if tagName != "" {
+				name = tagName
+			}
+			omitEmpty = options == "omitempty"
+		}
+		value := v.Field(i)
+		if omitEmpty && value.IsZero() {
+			continue
+		}
+		r.b.AppendSpace()
+		r.writeKey(name)
+		r.push(name)
+		r.writeValue(value, depth+1)
+		r.pop()
+		r.b.AppendSpace()
+	}
+	if r.l.color {
+		r.b.Purple()
+	}
+	r.b.AppendString("}")
+}
+
+// writeKey writes a nested key and its separator, leaving the value color set
+func (r *renderer) writeKey(key string) {
+	if r.l.color {
+		r.b.Orange()
+	}
+	r.b.AppendString(key)
+	if r.l.color {
+		r.b.White()
+	}
+	r.b.AppendString(":")
+	if r.l.color {
+		r.b.Cyan()
+	}
+}
@@ -0,0 +1,170 @@
+package fancylog
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// StackMode selects what is captured of the stack of the caller when logging at
+// a level
+type StackMode uint8
+
+const (
+	// StackDefault captures the full stack when the File flag of the prefix is
+	// set and nothing otherwise
+	StackDefault StackMode = iota
+	// StackNone captures nothing
+	StackNone
+	// StackCaller captures the frame of the caller only, written as
+	// file:line func below the entry
+	StackCaller
+	// StackFull captures up to StackOptions.Depth frames
+	StackFull
+)
+
+// StackOptions configures how stacks are captured and written
+type StackOptions struct {
+	// Depth is the maximum number of frames written, 20 when zero
+	Depth int
+	// SkipPatterns are function name prefixes, such as "github.com/me/wrapper.",
+	// whose frames are left out. The frames of this package, and its
+	// subpackages, are always left out
+	SkipPatterns []string
+	// FullPath writes the full path of files instead of their directory and name
+	FullPath bool
+}
+
+// DefaultStackOptions are used by loggers without stack options of their own
+// and by WithStack
+var DefaultStackOptions = StackOptions{Depth: 20}
+
+// packagePath is the import path of this package as compiled, so the frames of
+// forks and vendored copies are recognised too
+var packagePath = reflect.TypeOf((*Logger)(nil)).Elem().PkgPath()
+
+// SetStackMode sets what is captured of the stack when logging at level,
+// overriding the File flag of its prefix. The modes are replaced rather than
+// modified, so entries being logged read them without locking
+func (l *Logger) SetStackMode(level Level, mode StackMode) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var current map[Level]StackMode
+	if p := l.stackModes.Load(); p != nil {
+		current = *p
+	}
+	modes := make(map[Level]StackMode, len(current)+1)
+	for lvl, m := range current {
+		modes[lvl] = m
+	}
+	modes[level] = mode
+	l.stackModes.Store(&modes)
+}
+
+// SetStackOptions override the default stack options
+func (l *Logger) SetStackOptions(opts StackOptions) {
+	l.stackOptions.Store(&opts)
+}
+
+func (l *Logger) getStackOptions() StackOptions {
+	if opts := l.stackOptions.Load(); opts != nil {
+		return *opts
+	}
+	return DefaultStackOptions
+}
+
+// stackFor captures the stack written with entries of prefix, an empty string
+// when none is wanted
+func (l *Logger) stackFor(prefix Prefix) string {
+	mode := StackDefault
+	if modes := l.stackModes.Load(); modes != nil {
+		mode = (*modes)[prefix.Text]
+	}
+	if mode == StackDefault {
+		mode = StackNone
+		if prefix.File {
+			mode = StackFull
+		}
+	}
+	switch mode {
+	case StackCaller:
+		opts := l.getStackOptions()
+		opts.Depth = 1
+		return captureCaller(opts)
+	case StackFull:
+		return captureStack(l.getStackOptions())
+	}
+	return ""
+}
+
+// callerFrames returns up to depth frames of the caller, leaving out the frames
+// of this package and those matching the skip patterns
+func callerFrames(opts StackOptions) []runtime.Frame {
+	depth := opts.Depth
+	if depth <= 0 {
+		depth = 20
+	}
+	// Leave room for the frames skipped
+	pcs := make([]uintptr, depth+32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	captured := make([]runtime.Frame, 0, depth)
+	for len(captured) < depth {
+		frame, more := frames.Next()
+		if !skipFrame(frame.Function, opts.SkipPatterns) {
+			captured = append(captured, frame)
+		}
+		if !more {
+			break
+		}
+	}
+	return captured
+}
+
+func skipFrame(function string, patterns []string) bool {
+	if strings.HasPrefix(function, packagePath+".") || strings.HasPrefix(function, packagePath+"/") {
+		return true
+	}
+	for _, pattern := range patterns {
+		if strings.HasPrefix(function, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureStack produces the stack trace of the caller
+func captureStack(opts StackOptions) string {
+	var stack strings.Builder
+	for _, frame := range callerFrames(opts) {
+		stack.WriteString(fmt.Sprintf("\t%s()\n\t\t %s:%d\n", frame.Function, framePath(frame.File, opts.FullPath), frame.Line))
+	}
+	return stack.String()
+}
+
+// captureCaller produces the file:line func line of the caller
+func captureCaller(opts StackOptions) string {
+	frames := callerFrames(opts)
+	if len(frames) == 0 {
+		return ""
+	}
+	frame := frames[0]
+	return fmt.Sprintf("\t%s:%d %s()\n", framePath(frame.File, opts.FullPath), frame.Line, frame.Function)
+}
+
+// framePath returns file, or only its directory and name when full is unset
+func framePath(file string, full bool) string {
+	if full {
+		return file
+	}
+	idx := strings.LastIndexByte(file, '/')
+	if idx == -1 {
+		return file
+	}
+	idx = strings.LastIndexByte(file[:idx], '/')
+	if idx == -1 {
+		return file
+	}
+	return file[idx+1:]
+}
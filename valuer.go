@@ -0,0 +1,74 @@
+package fancylog
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// LogValuer is implemented by types controlling how they are rendered in logs,
+// such as a user logged by its id and email rather than every field. LogValue is
+// only called when an entry is written, so the work is skipped for disabled
+// levels. The returned value is rendered like any other value, and may itself be
+// a LogValuer
+type LogValuer interface {
+	LogValue() any
+}
+
+// Lazy defers computing a value until the entry is written
+type Lazy func() any
+
+// LogValue calls the function
+func (f Lazy) LogValue() any {
+	return f()
+}
+
+// maxLogValueDepth bounds the LogValuer chain followed for a single value, so a
+// type returning itself does not loop forever
+const maxLogValueDepth = 10
+
+// resolveLogValue follows LogValue until v is no longer a LogValuer. A panic in
+// LogValue is rendered in place of the value instead of taking the caller down
+func resolveLogValue(v any) (resolved any) {
+	defer func() {
+		if r := recover(); r != nil {
+			resolved = fmt.Sprintf("!PANIC(LogValue): %v", r)
+		}
+	}()
+	for i := 0; i < maxLogValueDepth; i++ {
+		lv, ok := v.(LogValuer)
+		if !ok || isNilPointer(v) {
+			return v
+		}
+		v = lv.LogValue()
+	}
+	return v
+}
+
+// resolveLogValues resolves every LogValuer in v, v is only copied when one is
+// found
+func resolveLogValues(v []any) []any {
+	var resolved []any
+	for i, value := range v {
+		if _, ok := value.(LogValuer); !ok {
+			continue
+		}
+		if resolved == nil {
+			resolved = make([]any, len(v))
+			copy(resolved, v)
+		}
+		resolved[i] = resolveLogValue(value)
+	}
+	if resolved == nil {
+		return v
+	}
+	return resolved
+}
+
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}